@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -26,8 +30,9 @@ var (
 )
 
 type webConfigType struct {
-	listenAddress   string
-	metricsEndpoint string
+	listenAddress       string
+	metricsEndpoint     string
+	shutdownGracePeriod time.Duration
 }
 
 type exporterConfigType struct {
@@ -35,12 +40,33 @@ type exporterConfigType struct {
 	couchdbUsername            string
 	couchdbPassword            string
 	couchdbInsecure            bool
+	couchdbNodeUris            string
+	couchdbNodeUriTemplate     string
 	scrapeInterval             time.Duration
 	scrapeLocalOnly            bool
+	scrapeMaxRequests          uint
+	scrapeMaxSnapshotAge       time.Duration
 	databases                  string
 	databaseViews              bool
+	databaseShard              string
+	databaseShardNodeMetrics   int
 	databaseConcurrentRequests uint
+	databaseAdaptive           bool
+	databaseAdaptiveLatency    time.Duration
+	circuitBreakerFailures     uint
+	circuitBreakerCooldown     time.Duration
 	schedulerJobs              bool
+	systemMessageQueues        string
+	httpdStatusCodes           string
+	httpdRequestMethods        string
+	metricNaming               string
+	collectors                 map[string]*collectorFlags
+}
+
+// collectorFlags holds the --collector.<name> and --no-collector.<name> flags of a collector
+type collectorFlags struct {
+	enabled  bool
+	disabled bool
 }
 
 var exporterConfig exporterConfigType
@@ -49,6 +75,7 @@ var webConfig webConfigType
 var configFileFlagname = "config"
 var webConfigFile = ""
 var enableFilteredScraping = false
+var filteredScrapingCacheAge time.Duration
 
 var appFlags []cli.Flag
 
@@ -80,6 +107,14 @@ func init() {
 			Value:       false,
 			Destination: &enableFilteredScraping,
 		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "filtered.scraping.cache.age",
+			Usage:       "Minimum age of cached results per collector group before scraping CouchDB again in filtered scraping mode. '0s' disables caching",
+			EnvVars:     []string{"FILTERED_SCRAPING_CACHE_AGE"},
+			Hidden:      false,
+			Value:       0 * time.Second,
+			Destination: &filteredScrapingCacheAge,
+		}),
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:        "telemetry.address",
 			Usage:       "Address on which to expose metrics",
@@ -96,6 +131,14 @@ func init() {
 			Value:       "/metrics",
 			Destination: &webConfig.metricsEndpoint,
 		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "web.shutdown-grace-period",
+			Usage:       "Time to wait for in-flight scrapes on shutdown, before their requests to CouchDB are cancelled",
+			EnvVars:     []string{"WEB_SHUTDOWN_GRACE_PERIOD"},
+			Hidden:      false,
+			Value:       30 * time.Second,
+			Destination: &webConfig.shutdownGracePeriod,
+		}),
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:        "couchdb.uri",
 			Usage:       "URI to the CouchDB instance",
@@ -128,6 +171,22 @@ func init() {
 			Value:       true,
 			Destination: &exporterConfig.couchdbInsecure,
 		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "couchdb.node-uris",
+			Usage:       "Comma separated list of 'node=uri' to scrape the nodes directly, e.g. 'couchdb@a=https://a:5984'. These nodes are still scraped while the coordinator at couchdb.uri is down",
+			EnvVars:     []string{"COUCHDB.NODE_URIS", "COUCHDB_NODE_URIS"},
+			Hidden:      false,
+			Value:       "",
+			Destination: &exporterConfig.couchdbNodeUris,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "couchdb.node-uri-template",
+			Usage:       "URI template to scrape the nodes of the cluster directly, replacing {host} and {name} of node names like 'name@host', e.g. 'https://{host}:5984'",
+			EnvVars:     []string{"COUCHDB.NODE_URI_TEMPLATE", "COUCHDB_NODE_URI_TEMPLATE"},
+			Hidden:      false,
+			Value:       "",
+			Destination: &exporterConfig.couchdbNodeUriTemplate,
+		}),
 		altsrc.NewDurationFlag(&cli.DurationFlag{
 			Name:        "scrape.interval",
 			Usage:       fmt.Sprintf("Duration between metrics collection from the CouchDB cluster. '0s' collects only on Prometheus scrapes"),
@@ -144,6 +203,22 @@ func init() {
 			Value:       false,
 			Destination: &exporterConfig.scrapeLocalOnly,
 		}),
+		altsrc.NewUintFlag(&cli.UintFlag{
+			Name:        "scrape.max-requests",
+			Usage:       "Maximum number of database and view requests per scrape, or 0 for unlimited. Databases exceeding the budget are scraped in rotation over successive scrapes",
+			EnvVars:     []string{"SCRAPE_MAX_REQUESTS"},
+			Hidden:      false,
+			Value:       0,
+			Destination: &exporterConfig.scrapeMaxRequests,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "scrape.max-snapshot-age",
+			Usage:       "Maximum age of the last successful scrape to be served when scraping asynchronously and CouchDB can't be scraped, or 0 to serve it until the next successful scrape",
+			EnvVars:     []string{"SCRAPE_MAX_SNAPSHOT_AGE"},
+			Hidden:      false,
+			Value:       0,
+			Destination: &exporterConfig.scrapeMaxSnapshotAge,
+		}),
 		// TODO use cli.StringSliceFlag?
 		altsrc.NewStringFlag(&cli.StringFlag{
 			Name:        "databases",
@@ -161,6 +236,22 @@ func init() {
 			Value:       true,
 			Destination: &exporterConfig.databaseViews,
 		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "databases.shard",
+			Usage:       "Only observe databases whose name hash falls into shard 'i/n' (e.g. '0/3'), so that several exporter instances can share the databases of a large cluster",
+			EnvVars:     []string{"DATABASES.SHARD", "DATABASES_SHARD"},
+			Hidden:      false,
+			Value:       "",
+			Destination: &exporterConfig.databaseShard,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:        "databases.shard.node-metrics",
+			Usage:       "Shard index which emits node-level metrics when using databases.shard, or -1 to emit them from every shard",
+			EnvVars:     []string{"DATABASES.SHARD.NODE_METRICS", "DATABASES_SHARD_NODE_METRICS"},
+			Hidden:      false,
+			Value:       0,
+			Destination: &exporterConfig.databaseShardNodeMetrics,
+		}),
 		altsrc.NewUintFlag(&cli.UintFlag{
 			Name:        "database.concurrent.requests",
 			Usage:       "maximum concurrent calls to CouchDB, or 0 for unlimited",
@@ -168,6 +259,38 @@ func init() {
 			Hidden:      false,
 			Destination: &exporterConfig.databaseConcurrentRequests,
 		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:        "database.concurrent.adaptive",
+			Usage:       "Adapt the concurrent calls to CouchDB's latency and 5xx errors, bounded by database.concurrent.requests (or 32 if unlimited)",
+			EnvVars:     []string{"DATABASE_CONCURRENT_ADAPTIVE"},
+			Hidden:      false,
+			Value:       false,
+			Destination: &exporterConfig.databaseAdaptive,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "database.concurrent.adaptive.latency",
+			Usage:       "Latency above which CouchDB is considered overloaded when using database.concurrent.adaptive",
+			EnvVars:     []string{"DATABASE_CONCURRENT_ADAPTIVE_LATENCY"},
+			Hidden:      false,
+			Value:       1 * time.Second,
+			Destination: &exporterConfig.databaseAdaptiveLatency,
+		}),
+		altsrc.NewUintFlag(&cli.UintFlag{
+			Name:        "scrape.circuit-breaker.failures",
+			Usage:       "Consecutive failures after which the databases and views collectors are paused, or 0 to disable the circuit breaker",
+			EnvVars:     []string{"SCRAPE_CIRCUIT_BREAKER_FAILURES"},
+			Hidden:      false,
+			Value:       0,
+			Destination: &exporterConfig.circuitBreakerFailures,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "scrape.circuit-breaker.cooldown",
+			Usage:       "Time a collector stays paused by the circuit breaker before it is tried again",
+			EnvVars:     []string{"SCRAPE_CIRCUIT_BREAKER_COOLDOWN"},
+			Hidden:      false,
+			Value:       5 * time.Minute,
+			Destination: &exporterConfig.circuitBreakerCooldown,
+		}),
 		altsrc.NewBoolFlag(&cli.BoolFlag{
 			Name:        "scheduler.jobs",
 			Usage:       "Collect active replication jobs (CouchDB 2.x+ only)",
@@ -175,7 +298,82 @@ func init() {
 			Hidden:      false,
 			Destination: &exporterConfig.schedulerJobs,
 		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "system.message-queues",
+			Usage:       "Comma separated list of the Erlang processes whose message queue length is exported, e.g. 'couch_server,couch_file,rexi_server', or empty for all processes",
+			EnvVars:     []string{"SYSTEM.MESSAGE_QUEUES", "SYSTEM_MESSAGE_QUEUES"},
+			Hidden:      false,
+			Value:       "",
+			Destination: &exporterConfig.systemMessageQueues,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "httpd.status-codes",
+			Usage:       "Comma separated list of the HTTP status codes whose response count is exported, e.g. '200,201,404,429,500,503', or empty for all status codes",
+			EnvVars:     []string{"HTTPD.STATUS_CODES", "HTTPD_STATUS_CODES"},
+			Hidden:      false,
+			Value:       "",
+			Destination: &exporterConfig.httpdStatusCodes,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "httpd.request-methods",
+			Usage:       "Comma separated list of the HTTP request methods whose request count is exported, e.g. 'GET,POST,PUT', or empty for all methods",
+			EnvVars:     []string{"HTTPD.REQUEST_METHODS", "HTTPD_REQUEST_METHODS"},
+			Hidden:      false,
+			Value:       "",
+			Destination: &exporterConfig.httpdRequestMethods,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "metrics.naming",
+			Usage:       fmt.Sprintf("Export CouchDB counters as gauges ('%s'), as counters with a _total suffix ('%s'), or both during a migration ('%s')", lib.MetricNamingLegacy, lib.MetricNamingPrometheus, lib.MetricNamingBoth),
+			EnvVars:     []string{"METRICS.NAMING", "METRICS_NAMING"},
+			Hidden:      false,
+			Value:       string(lib.MetricNamingLegacy),
+			Destination: &exporterConfig.metricNaming,
+		}),
+	}
+
+	exporterConfig.collectors = make(map[string]*collectorFlags)
+	for _, name := range lib.CollectorNames() {
+		flags := &collectorFlags{}
+		exporterConfig.collectors[name] = flags
+		envVar := "COLLECTOR_" + strings.ToUpper(name)
+		appFlags = append(appFlags,
+			altsrc.NewBoolFlag(&cli.BoolFlag{
+				Name:        "collector." + name,
+				Usage:       fmt.Sprintf("Enable the %s collector", name),
+				EnvVars:     []string{envVar},
+				Hidden:      false,
+				Value:       lib.CollectorEnabledByDefault(name),
+				Destination: &flags.enabled,
+			}),
+			altsrc.NewBoolFlag(&cli.BoolFlag{
+				Name:        "no-collector." + name,
+				Usage:       fmt.Sprintf("Disable the %s collector", name),
+				EnvVars:     []string{"NO_" + envVar},
+				Hidden:      false,
+				Destination: &flags.disabled,
+			}))
+	}
+}
+
+// enabledCollectors resolves the collector flags, --no-collector.<name> taking precedence
+func enabledCollectors() map[string]bool {
+	collectors := make(map[string]bool, len(exporterConfig.collectors))
+	for name, flags := range exporterConfig.collectors {
+		collectors[name] = flags.enabled && !flags.disabled
+	}
+	return collectors
+}
+
+// splitList splits a comma separated list of values, trimming the whitespace around them and skipping empty values
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
 	}
+	return values
 }
 
 func ofBool(i bool) *bool {
@@ -194,6 +392,27 @@ func main() {
 		if exporterConfig.databases != "" {
 			databases = strings.Split(exporterConfig.databases, ",")
 		}
+		messageQueues := splitList(exporterConfig.systemMessageQueues)
+		httpStatusCodes := splitList(exporterConfig.httpdStatusCodes)
+		httpRequestMethods := splitList(exporterConfig.httpdRequestMethods)
+		databaseShard, err := lib.ParseDatabaseShard(exporterConfig.databaseShard)
+		if err != nil {
+			return err
+		}
+		databaseShard.NodeMetricsShard = exporterConfig.databaseShardNodeMetrics
+		if err := databaseShard.Validate(); err != nil {
+			return err
+		}
+		nodeUris, err := lib.ParseNodeUris(exporterConfig.couchdbNodeUris, exporterConfig.couchdbNodeUriTemplate)
+		if err != nil {
+			return err
+		}
+		metricNaming, err := lib.ParseMetricNaming(exporterConfig.metricNaming)
+		if err != nil {
+			return err
+		}
+
+		var exporter *lib.Exporter
 
 		if enableFilteredScraping {
 			// Use the filtered scraping mode (node_exporter style)
@@ -211,16 +430,33 @@ func main() {
 					CollectViews:         exporterConfig.databaseViews,
 					CollectSchedulerJobs: exporterConfig.schedulerJobs,
 					ConcurrentRequests:   exporterConfig.databaseConcurrentRequests,
+					FilteredCacheAge:     filteredScrapingCacheAge,
+					DatabaseShard:        databaseShard,
+					MaxRequests:          exporterConfig.scrapeMaxRequests,
+
+					AdaptiveConcurrency:      exporterConfig.databaseAdaptive,
+					AdaptiveLatencyThreshold: exporterConfig.databaseAdaptiveLatency,
+					CircuitBreakerFailures:   exporterConfig.circuitBreakerFailures,
+					CircuitBreakerCooldown:   exporterConfig.circuitBreakerCooldown,
+					NodeUris:                 nodeUris,
+					MessageQueues:            messageQueues,
+					HttpStatusCodes:          httpStatusCodes,
+					HttpRequestMethods:       httpRequestMethods,
+					MetricNaming:             metricNaming,
+
+					Collectors: enabledCollectors(),
 				},
 				exporterConfig.couchdbInsecure)
 
+			exporter = filteredExporter.Exporter
+
 			// Use the filtered handler that supports collect[] parameters
 			http.Handle(webConfig.metricsEndpoint, lib.CreateFilteredHandler(filteredExporter))
 		} else {
 			// Use the traditional global registry mode (backward compatible)
 			slog.Info("Traditional scraping mode - collecting all metrics on every scrape")
 			
-			exporter := lib.NewExporter(
+			exporter = lib.NewExporter(
 				exporterConfig.couchdbURI,
 				exporterConfig.scrapeLocalOnly,
 				lib.BasicAuth{
@@ -232,6 +468,21 @@ func main() {
 					CollectViews:         exporterConfig.databaseViews,
 					CollectSchedulerJobs: exporterConfig.schedulerJobs,
 					ConcurrentRequests:   exporterConfig.databaseConcurrentRequests,
+					DatabaseShard:        databaseShard,
+					MaxRequests:          exporterConfig.scrapeMaxRequests,
+					MaxSnapshotAge:       exporterConfig.scrapeMaxSnapshotAge,
+
+					AdaptiveConcurrency:      exporterConfig.databaseAdaptive,
+					AdaptiveLatencyThreshold: exporterConfig.databaseAdaptiveLatency,
+					CircuitBreakerFailures:   exporterConfig.circuitBreakerFailures,
+					CircuitBreakerCooldown:   exporterConfig.circuitBreakerCooldown,
+					NodeUris:                 nodeUris,
+					MessageQueues:            messageQueues,
+					HttpStatusCodes:          httpStatusCodes,
+					HttpRequestMethods:       httpRequestMethods,
+					MetricNaming:             metricNaming,
+
+					Collectors: enabledCollectors(),
 				},
 				exporterConfig.couchdbInsecure)
 			prometheus.MustRegister(exporter)
@@ -299,10 +550,31 @@ func main() {
 			WebSystemdSocket:   ofBool(false),
 			WebConfigFile:      ofString(webConfigFile),
 		}
-		if err := web.ListenAndServe(server, &flags, logger); err != nil {
-			slog.Error("Failed to start the server", "err", err)
-			os.Exit(1)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		serverErr := make(chan error, 1)
+		go func() {
+			serverErr <- web.ListenAndServe(server, &flags, logger)
+		}()
+		select {
+		case err := <-serverErr:
+			exporter.Stop()
+			return fmt.Errorf("failed to start the server: %v", err)
+		case <-ctx.Done():
+		}
+
+		slog.Info(fmt.Sprintf("Shutting down, waiting up to %v for in-flight scrapes", webConfig.shutdownGracePeriod))
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), webConfig.shutdownGracePeriod)
+		defer cancel()
+		err = server.Shutdown(shutdownCtx)
+		if err != nil {
+			slog.Warn("Shutdown grace period exceeded, cancelling in-flight scrapes", "err", err)
+		}
+		exporter.Stop()
+		if err := <-serverErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
 		}
+		slog.Info("Exporter stopped")
 		return nil
 	}
 
@@ -320,6 +592,7 @@ func main() {
 	err := app.Run(os.Args)
 	if err != nil {
 		slog.Error(fmt.Sprintf("%v", err))
+		os.Exit(1)
 	}
 }
 
@@ -11,11 +11,14 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gesellix/couchdb-cluster-config/v17/pkg"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/gesellix/couchdb-prometheus-exporter/v30/lib"
@@ -72,7 +75,7 @@ func readFile(t *testing.T, filename string) []byte {
 func couchdbResponse(t *testing.T, versionSuffix string) Handler {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var err error
-		if r.URL.Path == "/" {
+		if r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/_node/") && strings.HasSuffix(r.URL.Path, "/") {
 			response := readFile(t, fmt.Sprintf("./testdata/couchdb-%s.json", versionSuffix))
 			_, err = w.Write(response)
 		} else if r.URL.Path == "/_all_dbs" {
@@ -181,20 +184,383 @@ func performCouchdbStatsTest(t *testing.T, scrapeInterval time.Duration, couchdb
 }
 
 func TestCouchdbStatsV1(t *testing.T) {
-	performCouchdbStatsTest(t, 0, "v1", 59, 4711, 12396, 11)
+	performCouchdbStatsTest(t, 0, "v1", 83, 4711, 12396, 11)
 }
 
 func TestCouchdbStatsV2(t *testing.T) {
-	performCouchdbStatsTest(t, 0, "v2", 307, 4712, 58570, 17)
+	performCouchdbStatsTest(t, 0, "v2", 444, 4712, 58570, 17)
 }
 
 func TestCouchdbStatsV2Async(t *testing.T) {
 	scrapeInterval, _ := time.ParseDuration("1s")
-	performCouchdbStatsTest(t, scrapeInterval, "v2", 307, 4712, 58570, 17)
+	performCouchdbStatsTest(t, scrapeInterval, "v2", 444, 4712, 58570, 17)
 }
 
 func TestCouchdbStatsV2Prerelease(t *testing.T) {
-	performCouchdbStatsTest(t, 0, "v2-pre", 295, 4712, 58570, 17)
+	performCouchdbStatsTest(t, 0, "v2-pre", 432, 4712, 58570, 17)
+}
+
+func TestScrapePhaseDurations(t *testing.T) {
+	basicAuth := lib.BasicAuth{Username: "username", Password: "password"}
+	server := httptest.NewServer(http.HandlerFunc(BasicAuthHandler(basicAuth, couchdbResponse(t, "v2"))))
+	defer server.Close()
+
+	e := lib.NewExporter(server.URL, false, basicAuth, lib.CollectorConfig{
+		Databases:            []string{"example", "another-example"},
+		CollectViews:         true,
+		CollectSchedulerJobs: true,
+	}, true)
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		defer close(ch)
+		e.Collect(ch)
+	}()
+	metricFamilies := testutil.CollectMetrics(ch, false)
+
+	duration, err := testutil.GetGaugeValue(metricFamilies, "couchdb_exporter_scrape_duration_seconds", "", "")
+	if err != nil {
+		t.Error(err)
+	}
+	for _, phase := range []string{"version", "membership", "node_stats", "databases", "views", "scheduler", "active_tasks", "all_dbs", "system"} {
+		phaseDuration, err := testutil.GetGaugeValue(metricFamilies, "couchdb_exporter_scrape_phase_duration_seconds", "phase", phase)
+		if err != nil {
+			t.Error(err)
+		}
+		if phaseDuration <= 0 || phaseDuration > duration {
+			t.Errorf("expected phase %s to take between 0 and %f seconds, got %f", phase, duration, phaseDuration)
+		}
+	}
+}
+
+func TestDisabledCollectors(t *testing.T) {
+	basicAuth := lib.BasicAuth{Username: "username", Password: "password"}
+	var couchdbRequests int64
+	server := httptest.NewServer(http.HandlerFunc(countingHandler(&couchdbRequests, 0, BasicAuthHandler(basicAuth, couchdbResponse(t, "v2")))))
+	defer server.Close()
+
+	e := lib.NewExporter(server.URL, false, basicAuth, lib.CollectorConfig{
+		Databases:    []string{"example", "another-example"},
+		CollectViews: true,
+		Collectors: map[string]bool{
+			"databases":    false,
+			"views":        false,
+			"system":       false,
+			"active_tasks": false,
+		},
+	}, true)
+
+	metricFamilies := collectExporter(e)
+	for _, name := range []string{"couchdb_httpd_node_up", "couchdb_mango_query_time", "couchdb_fabric_worker", "couchdb_replicator_jobs"} {
+		if _, ok := metricFamilies[name]; !ok {
+			t.Errorf("expected %s from an enabled collector", name)
+		}
+	}
+	for _, name := range []string{"couchdb_database_disk_size", "couchdb_httpd_databases_total", "couchdb_view_staleness", "couchdb_erlang_memory_atom", "couchdb_server_active_tasks"} {
+		if _, ok := metricFamilies[name]; ok {
+			t.Errorf("expected no %s from a disabled collector", name)
+		}
+	}
+
+	// version, membership and the stats and info of both nodes
+	requestCount, err := testutil.GetGaugeValue(metricFamilies, "couchdb_exporter_request_count", "", "")
+	if err != nil {
+		t.Error(err)
+	}
+	if requestCount != 6 || atomic.LoadInt64(&couchdbRequests) != 6 {
+		t.Errorf("expected 6 requests to CouchDB, got %f (%d)", requestCount, atomic.LoadInt64(&couchdbRequests))
+	}
+}
+
+func collectExporter(e prometheus.Collector) map[string]*dto.MetricFamily {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		defer close(ch)
+		e.Collect(ch)
+	}()
+	return testutil.CollectMetrics(ch, false)
+}
+
+func awaitGauge(t *testing.T, e prometheus.Collector, metricDesc string, condition func(float64) bool) map[string]*dto.MetricFamily {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		metricFamilies := collectExporter(e)
+		value, err := testutil.GetGaugeValue(metricFamilies, metricDesc, "", "")
+		if err == nil && condition(value) {
+			return metricFamilies
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", metricDesc)
+	return nil
+}
+
+func TestAsyncScrapingServesLastGoodSnapshot(t *testing.T) {
+	basicAuth := lib.BasicAuth{Username: "username", Password: "password"}
+	var failing atomic.Bool
+	couchdb := BasicAuthHandler(basicAuth, couchdbResponse(t, "v2"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		couchdb(w, r)
+	}))
+	defer server.Close()
+
+	e := lib.NewExporter(server.URL, false, basicAuth, lib.CollectorConfig{
+		ScrapeInterval: 50 * time.Millisecond,
+		Databases:      []string{"example", "another-example"},
+		MaxSnapshotAge: 500 * time.Millisecond,
+	}, true)
+
+	healthy := awaitGauge(t, e, "couchdb_httpd_up", func(up float64) bool { return up == 1 })
+	lastSuccess, err := testutil.GetGaugeValue(healthy, "couchdb_exporter_last_success_timestamp_seconds", "", "")
+	if err != nil || lastSuccess == 0 {
+		t.Errorf("expected a last success timestamp, got %f (%v)", lastSuccess, err)
+	}
+
+	failing.Store(true)
+	stale := awaitGauge(t, e, "couchdb_httpd_up", func(up float64) bool { return up == 0 })
+	if _, ok := stale["couchdb_database_disk_size"]; !ok {
+		t.Errorf("expected the last good snapshot to be served after a failed scrape")
+	}
+	if failures := stale["couchdb_exporter_scrape_failures_total"].GetMetric()[0].GetCounter().GetValue(); failures < 1 {
+		t.Errorf("expected failed scrapes to be counted, got %f", failures)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	expired := collectExporter(e)
+	if _, ok := expired["couchdb_database_disk_size"]; ok {
+		t.Errorf("expected the snapshot to be dropped after its max age")
+	}
+	if _, ok := expired["couchdb_exporter_last_success_timestamp_seconds"]; !ok {
+		t.Errorf("expected the last success timestamp to be served after the snapshot expired")
+	}
+}
+
+func TestStopCancelsInFlightScrapes(t *testing.T) {
+	blocked := make(chan struct{}, 1)
+	cancelled := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blocked <- struct{}{}
+		<-r.Context().Done()
+		cancelled <- struct{}{}
+	}))
+	defer server.Close()
+
+	e := lib.NewExporter(server.URL, false, lib.BasicAuth{}, lib.CollectorConfig{
+		ScrapeInterval: 10 * time.Millisecond,
+	}, true)
+	select {
+	case <-blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no scrape started")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		e.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return while a scrape was in flight")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight request to CouchDB not cancelled")
+	}
+}
+
+func countingHandler(count *int64, delay time.Duration, pass Handler) Handler {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(count, 1)
+		time.Sleep(delay)
+		pass(w, r)
+	}
+}
+
+func scrapeFiltered(t *testing.T, handler http.Handler, query string) string {
+	req := httptest.NewRequest("GET", "/metrics"+query, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestFilteredScrapingSharesConcurrentScrapes(t *testing.T) {
+	basicAuth := lib.BasicAuth{Username: "username", Password: "password"}
+	var couchdbRequests int64
+	handler := http.HandlerFunc(countingHandler(&couchdbRequests, 10*time.Millisecond, BasicAuthHandler(basicAuth, couchdbResponse(t, "v2"))))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	e := lib.NewFilteredExporter(server.URL, false, basicAuth, lib.CollectorConfig{
+		Databases:            []string{"example", "another-example"},
+		CollectViews:         true,
+		CollectSchedulerJobs: true,
+	}, true)
+	filteredHandler := lib.CreateFilteredHandler(e)
+
+	scrapeFiltered(t, filteredHandler, "?collect[]=standard&collect[]=databases")
+	requestsPerScrape := atomic.LoadInt64(&couchdbRequests)
+	atomic.StoreInt64(&couchdbRequests, 0)
+
+	// requests for the same groups share a scrape, regardless of the order of the parameters
+	var wg sync.WaitGroup
+	for _, query := range []string{"?collect[]=standard&collect[]=databases", "?collect[]=databases&collect[]=standard", "?collect[]=Standard&collect[]=databases&exclude[]=views"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scrapeFiltered(t, filteredHandler, query)
+		}()
+	}
+	wg.Wait()
+
+	if actual := atomic.LoadInt64(&couchdbRequests); actual != requestsPerScrape {
+		t.Errorf("expected concurrent requests to share a single scrape with %d CouchDB requests, got %d", requestsPerScrape, actual)
+	}
+}
+
+func TestFilteredScrapingCache(t *testing.T) {
+	basicAuth := lib.BasicAuth{Username: "username", Password: "password"}
+	var couchdbRequests int64
+	handler := http.HandlerFunc(countingHandler(&couchdbRequests, 0, BasicAuthHandler(basicAuth, couchdbResponse(t, "v2"))))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	e := lib.NewFilteredExporter(server.URL, false, basicAuth, lib.CollectorConfig{
+		Databases:        []string{"example", "another-example"},
+		FilteredCacheAge: time.Minute,
+	}, true)
+	filteredHandler := lib.CreateFilteredHandler(e)
+
+	first := scrapeFiltered(t, filteredHandler, "?collect[]=standard&collect[]=databases")
+	requestsPerScrape := atomic.LoadInt64(&couchdbRequests)
+
+	second := scrapeFiltered(t, filteredHandler, "?collect[]=standard")
+	if actual := atomic.LoadInt64(&couchdbRequests); actual != requestsPerScrape {
+		t.Errorf("expected cached results to be served without CouchDB requests, got %d additional requests", actual-requestsPerScrape)
+	}
+	if !strings.Contains(first, "couchdb_database_disk_size{db_name=\"example\"} 58570") {
+		t.Errorf("expected database metrics with collect[]=databases")
+	}
+	if !strings.Contains(second, "couchdb_httpd_up 1") {
+		t.Errorf("expected standard metrics in response")
+	}
+	if strings.Contains(second, "couchdb_database_disk_size") {
+		t.Errorf("expected no database metrics without collect[]=databases")
+	}
+
+	scrapeFiltered(t, filteredHandler, "?collect[]=views")
+	if actual := atomic.LoadInt64(&couchdbRequests); actual == requestsPerScrape {
+		t.Errorf("expected a scrape for the views group, which wasn't cached")
+	}
+}
+
+func TestFilteredScrapingWithoutGroups(t *testing.T) {
+	basicAuth := lib.BasicAuth{Username: "username", Password: "password"}
+	var couchdbRequests int64
+	server := httptest.NewServer(http.HandlerFunc(countingHandler(&couchdbRequests, 0, BasicAuthHandler(basicAuth, couchdbResponse(t, "v2")))))
+	defer server.Close()
+
+	e := lib.NewFilteredExporter(server.URL, false, basicAuth, lib.CollectorConfig{
+		Databases: []string{"example", "another-example"},
+	}, true)
+	filteredHandler := lib.CreateFilteredHandler(e)
+
+	if body := scrapeFiltered(t, filteredHandler, "?exclude[]=standard"); body != "" {
+		t.Errorf("expected an empty response without any group, got %s", body)
+	}
+	if actual := atomic.LoadInt64(&couchdbRequests); actual != 0 {
+		t.Errorf("expected no CouchDB requests without any group, got %d", actual)
+	}
+}
+
+func TestFilteredScrapingDatabaseSelection(t *testing.T) {
+	basicAuth := lib.BasicAuth{Username: "username", Password: "password"}
+	server := httptest.NewServer(http.HandlerFunc(BasicAuthHandler(basicAuth, couchdbResponse(t, "v2"))))
+	defer server.Close()
+
+	e := lib.NewFilteredExporter(server.URL, false, basicAuth, lib.CollectorConfig{
+		Databases:    []string{"example", "another-example"},
+		CollectViews: true,
+	}, true)
+	filteredHandler := lib.CreateFilteredHandler(e)
+
+	selected := scrapeFiltered(t, filteredHandler, "?collect[]=standard&collect[]=databases&exclude[]=scheduler&db[]=example")
+	if !strings.Contains(selected, "couchdb_database_disk_size{db_name=\"example\"}") {
+		t.Errorf("expected metrics for the selected database")
+	}
+	if strings.Contains(selected, "db_name=\"another-example\"") {
+		t.Errorf("expected no metrics for databases outside of the selection")
+	}
+	if !strings.Contains(selected, "couchdb_httpd_up 1") {
+		t.Errorf("expected standard metrics in response")
+	}
+
+	regex := scrapeFiltered(t, filteredHandler, "?collect[]=databases&db_regex=^another-")
+	if !strings.Contains(regex, "couchdb_database_disk_size{db_name=\"another-example\"}") {
+		t.Errorf("expected metrics for the database matching db_regex")
+	}
+	if strings.Contains(regex, "db_name=\"example\"") {
+		t.Errorf("expected no metrics for databases not matching db_regex")
+	}
+
+	req := httptest.NewRequest("GET", "/metrics?db_regex=[", nil)
+	rec := httptest.NewRecorder()
+	filteredHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for an invalid db_regex, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestCircuitBreakerPausesFailingDatabases(t *testing.T) {
+	basicAuth := lib.BasicAuth{Username: "username", Password: "password"}
+	var databaseRequests int64
+	couchdb := BasicAuthHandler(basicAuth, couchdbResponse(t, "v2"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/another-example" {
+			atomic.AddInt64(&databaseRequests, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		couchdb(w, r)
+	}))
+	defer server.Close()
+
+	e := lib.NewFilteredExporter(server.URL, false, basicAuth, lib.CollectorConfig{
+		Databases:              []string{"example", "another-example"},
+		CircuitBreakerFailures: 2,
+		CircuitBreakerCooldown: time.Hour,
+	}, true)
+	filteredHandler := lib.CreateFilteredHandler(e)
+
+	query := "?collect[]=standard&collect[]=databases"
+	scrapeFiltered(t, filteredHandler, query)
+	scrapeFiltered(t, filteredHandler, query)
+	failedRequests := atomic.LoadInt64(&databaseRequests)
+
+	paused := scrapeFiltered(t, filteredHandler, query)
+	if actual := atomic.LoadInt64(&databaseRequests); actual != failedRequests {
+		t.Errorf("expected no database requests while the circuit is open, got %d", actual-failedRequests)
+	}
+	if !strings.Contains(paused, "couchdb_exporter_circuit_open{collector=\"databases\"} 1") {
+		t.Errorf("expected open circuit for the databases collector")
+	}
+	if !strings.Contains(paused, "couchdb_httpd_up 1") {
+		t.Errorf("expected standard metrics to be collected while the circuit is open")
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"couch_server", "couch_file", "rexi_server"}, splitList(" couch_server, couch_file ,,rexi_server "))
+	assert.Nil(t, splitList(""))
 }
 
 func TestCouchdbStatsV1Integration(t *testing.T) {
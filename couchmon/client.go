@@ -0,0 +1,359 @@
+// Package couchmon provides typed, context-aware access to the monitoring endpoints of CouchDB,
+// like _stats, _system, _active_tasks, _scheduler/jobs and the database and view infos.
+package couchmon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Requester sends a request to CouchDB and returns the response body.
+// Responses with a status code other than 2xx or 3xx are returned as *HttpError.
+type Requester interface {
+	RequestWithContext(ctx context.Context, method string, uri string, body io.Reader) ([]byte, error)
+}
+
+// Client reads the monitoring endpoints of a CouchDB server or cluster
+type Client struct {
+	baseUri   string
+	requester Requester
+}
+
+// Option configures a Client created with NewClient
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	httpClient *http.Client
+	username   string
+	password   string
+	requester  Requester
+}
+
+// WithHTTPClient sends the requests with the client, defaults to http.DefaultClient
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *clientOptions) {
+		o.httpClient = client
+	}
+}
+
+// WithBasicAuth sets the credentials for CouchDB
+func WithBasicAuth(username string, password string) Option {
+	return func(o *clientOptions) {
+		o.username = username
+		o.password = password
+	}
+}
+
+// WithRequester sends the requests with the requester, e.g. to share its instrumentation or rate limits.
+// The http client and credentials are ignored then.
+func WithRequester(requester Requester) Option {
+	return func(o *clientOptions) {
+		o.requester = requester
+	}
+}
+
+// NewClient creates a client for the CouchDB at baseUri, e.g. http://localhost:5984
+func NewClient(baseUri string, opts ...Option) *Client {
+	o := &clientOptions{httpClient: http.DefaultClient}
+	for _, opt := range opts {
+		opt(o)
+	}
+	requester := o.requester
+	if requester == nil {
+		requester = &httpRequester{client: o.httpClient, username: o.username, password: o.password}
+	}
+	return &Client{
+		baseUri:   strings.TrimSuffix(baseUri, "/"),
+		requester: requester,
+	}
+}
+
+// BaseUri returns the URI of the CouchDB the client reads from
+func (c *Client) BaseUri() string {
+	return c.baseUri
+}
+
+// get requests the endpoint relative to the base URI and decodes the response into v
+func (c *Client) get(ctx context.Context, endpoint string, v interface{}) error {
+	data, err := c.requester.RequestWithContext(ctx, "GET", fmt.Sprintf("%s/%s", c.baseUri, endpoint), nil)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return &DecodeError{Endpoint: endpoint, Err: err}
+	}
+	return nil
+}
+
+// ServerInfo returns the info of the server, including its version
+func (c *Client) ServerInfo(ctx context.Context) (NodeInfo, error) {
+	var nodeInfo NodeInfo
+	err := c.get(ctx, "", &nodeInfo)
+	if err != nil {
+		return NodeInfo{}, err
+	}
+	return nodeInfo, nil
+}
+
+// NodeServerInfo returns the info of a node, including its version, as answered by the node itself (CouchDB 2.x+)
+func (c *Client) NodeServerInfo(ctx context.Context, nodeName string) (NodeInfo, error) {
+	var nodeInfo NodeInfo
+	err := c.get(ctx, fmt.Sprintf("_node/%s/", nodeName), &nodeInfo)
+	if err != nil {
+		return NodeInfo{}, err
+	}
+	return nodeInfo, nil
+}
+
+// MajorVersion returns the major version of the server, e.g. 1 for CouchDB 1.x
+func (c *Client) MajorVersion(ctx context.Context) (int, error) {
+	nodeInfo, err := c.ServerInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return nodeInfo.MajorVersion()
+}
+
+// Membership returns the nodes of the cluster (CouchDB 2.x+)
+func (c *Client) Membership(ctx context.Context) (MembershipResponse, error) {
+	var membership MembershipResponse
+	err := c.get(ctx, "_membership", &membership)
+	if err != nil {
+		return MembershipResponse{}, err
+	}
+	return membership, nil
+}
+
+// NodeNames returns the names of the cluster nodes, or only the name of the node behind the base URI
+// when localOnly is set (CouchDB 2.x+)
+func (c *Client) NodeNames(ctx context.Context, localOnly bool) ([]string, error) {
+	if !localOnly {
+		membership, err := c.Membership(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return membership.ClusterNodes, nil
+	}
+	var local MembershipResponse
+	err := c.get(ctx, "_node/_local", &local)
+	if err != nil {
+		return nil, err
+	}
+	return []string{local.SingleNode}, nil
+}
+
+// NodeStats returns the stats of a node, which may be "_local" for the node behind the base URI (CouchDB 2.x+)
+func (c *Client) NodeStats(ctx context.Context, nodeName string) (StatsResponse, error) {
+	return c.getStats(ctx, fmt.Sprintf("_node/%s/_stats", nodeName))
+}
+
+// ServerStats returns the stats of the server (CouchDB 1.x)
+func (c *Client) ServerStats(ctx context.Context) (StatsResponse, error) {
+	return c.getStats(ctx, "_stats")
+}
+
+// getStats decodes the stats, keeping the whole response for StatsResponse.Statistics
+func (c *Client) getStats(ctx context.Context, endpoint string) (StatsResponse, error) {
+	var raw json.RawMessage
+	err := c.get(ctx, endpoint, &raw)
+	if err != nil {
+		return StatsResponse{}, err
+	}
+	var stats StatsResponse
+	err = json.Unmarshal(raw, &stats)
+	if err != nil {
+		return StatsResponse{}, &DecodeError{Endpoint: endpoint, Err: err}
+	}
+	stats.raw = raw
+	return stats, nil
+}
+
+// NodeSystem returns the Erlang VM stats of a node, which may be "_local" for the node behind the base URI (CouchDB 2.x+)
+func (c *Client) NodeSystem(ctx context.Context, nodeName string) (SystemResponse, error) {
+	var system SystemResponse
+	err := c.get(ctx, fmt.Sprintf("_node/%s/_system", nodeName), &system)
+	if err != nil {
+		return SystemResponse{}, err
+	}
+	if memory := &system.MemoryStatsResponse; memory.Total == 0 {
+		// like erlang:memory(total), the sum of the processes and the system memory
+		memory.Total = memory.Processes + memory.Atom + memory.Binary + memory.Code + memory.Ets + memory.Other
+	}
+	return system, nil
+}
+
+// NodeVersions returns the runtime versions of a node (CouchDB 3.2+)
+func (c *Client) NodeVersions(ctx context.Context, nodeName string) (VersionsResponse, error) {
+	var versions VersionsResponse
+	err := c.get(ctx, fmt.Sprintf("_node/%s/_versions", nodeName), &versions)
+	if err != nil {
+		return VersionsResponse{}, err
+	}
+	return versions, nil
+}
+
+// SchedulerJobs returns the replication jobs of the scheduler (CouchDB 2.x+)
+func (c *Client) SchedulerJobs(ctx context.Context) (SchedulerJobsResponse, error) {
+	var schedulerJobs SchedulerJobsResponse
+	err := c.get(ctx, "_scheduler/jobs", &schedulerJobs)
+	if err != nil {
+		return SchedulerJobsResponse{}, err
+	}
+	return schedulerJobs, nil
+}
+
+// ActiveTasks returns the running tasks of the cluster, or only of the node behind the base URI when localOnly is set.
+// Tasks without a node (CouchDB 1.x) are assigned to "_local" or "master".
+func (c *Client) ActiveTasks(ctx context.Context, localOnly bool) (ActiveTasksResponse, error) {
+	endpoint := "_active_tasks"
+	if localOnly {
+		endpoint = "_node/_local/_active_tasks"
+	}
+	var activeTasks ActiveTasksResponse
+	err := c.get(ctx, endpoint, &activeTasks)
+	if err != nil {
+		return ActiveTasksResponse{}, err
+	}
+	for i := range activeTasks {
+		if activeTasks[i].Node == "" {
+			if localOnly {
+				activeTasks[i].Node = "_local"
+			} else {
+				activeTasks[i].Node = "master"
+			}
+		}
+	}
+	return activeTasks, nil
+}
+
+// AllDbs returns the names of all databases
+func (c *Client) AllDbs(ctx context.Context) ([]string, error) {
+	var dbs []string
+	err := c.get(ctx, "_all_dbs", &dbs)
+	if err != nil {
+		return nil, err
+	}
+	return dbs, nil
+}
+
+// DatabaseInfo returns the info of a database
+func (c *Client) DatabaseInfo(ctx context.Context, dbName string) (DatabaseInfo, error) {
+	var dbInfo DatabaseInfo
+	err := c.get(ctx, url.QueryEscape(dbName), &dbInfo)
+	if err != nil {
+		return DatabaseInfo{}, err
+	}
+	if dbInfo.DiskSize == 0 && dbInfo.Sizes.File > 0 {
+		dbInfo.DiskSizeOverhead = dbInfo.Sizes.File - dbInfo.Sizes.Active
+	} else {
+		dbInfo.DiskSizeOverhead = dbInfo.DiskSize - dbInfo.DataSize
+	}
+	if dbInfo.CompactRunningBool {
+		dbInfo.CompactRunning = 1
+	} else {
+		dbInfo.CompactRunning = 0
+	}
+	return dbInfo, nil
+}
+
+// DesignDocs returns the design documents of a database
+func (c *Client) DesignDocs(ctx context.Context, dbName string) (DocsResponse, error) {
+	query := strings.Join([]string{
+		"startkey=\"_design/\"",
+		"endkey=\"_design0\"",
+		"include_docs=true",
+	}, "&")
+	var designDocs DocsResponse
+	err := c.get(ctx, fmt.Sprintf("%s/_all_docs?%s", url.QueryEscape(dbName), query), &designDocs)
+	if err != nil {
+		return DocsResponse{}, err
+	}
+	return designDocs, nil
+}
+
+// ViewUpdateSeq returns the update sequence of a view, without triggering an index update
+func (c *Client) ViewUpdateSeq(ctx context.Context, dbName string, designDocId string, viewName string) (string, error) {
+	query := strings.Join([]string{
+		"stale=ok",
+		"update=false",
+		"stable=true",
+		"update_seq=true",
+		"include_docs=false",
+		"limit=0",
+	}, "&")
+	var viewDoc ViewResponse
+	err := c.get(ctx, fmt.Sprintf("%s/%s/_view/%s?%s", url.QueryEscape(dbName), designDocId, viewName, query), &viewDoc)
+	if err != nil {
+		return "", err
+	}
+	if viewDoc.Error != "" {
+		return "", errors.New(fmt.Sprintf("%s, reason: %s", viewDoc.Error, viewDoc.Reason))
+	}
+	return ParseUpdateSeq(viewDoc.UpdateSeq)
+}
+
+// ParseUpdateSeq returns the update sequence of a database or view as string,
+// which is a number for CouchDB 1.x and an opaque string for CouchDB 2.x+.
+// See DecodeUpdateSeq in the lib package to decode the shard ranges of the latter.
+func ParseUpdateSeq(message json.RawMessage) (string, error) {
+	var updateSeq string
+	err := json.Unmarshal(message, &updateSeq)
+	if err == nil {
+		return updateSeq, nil
+	}
+	var intSeq int64
+	err = json.Unmarshal(message, &intSeq)
+	if err != nil {
+		return "", &DecodeError{Endpoint: "update_seq", Err: err}
+	}
+	return strconv.FormatInt(intSeq, 10), nil
+}
+
+// httpRequester sends the requests with a plain http.Client
+type httpRequester struct {
+	client   *http.Client
+	username string
+	password string
+}
+
+func (r *httpRequester) RequestWithContext(ctx context.Context, method string, uri string, body io.Reader) (respData []byte, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(r.username) > 0 {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := resp.Body.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	respData, err = io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		if err != nil {
+			respData = []byte(err.Error())
+		}
+		return nil, NewHttpError(resp.Status, resp.StatusCode, respData)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return respData, nil
+}
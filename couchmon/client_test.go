@@ -0,0 +1,180 @@
+package couchmon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testServer(t *testing.T, files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"not_found","reason":"missing"}`))
+			return
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(content)
+	}))
+}
+
+func TestClientV2(t *testing.T) {
+	server := testServer(t, map[string]string{
+		"/":                              "../testdata/couchdb-v2.json",
+		"/_membership":                   "../testdata/couchdb-membership-response-v2.json",
+		"/_node/node1@127.0.0.1/_stats":  "../testdata/couchdb-stats-response-v2.json",
+		"/_scheduler/jobs":               "../testdata/scheduler-jobs-v2.json",
+		"/example":                       "../testdata/example-meta-v2.json",
+		"/example/_design/views/_view/x": "../testdata/example-view-stale-v2.json",
+	})
+	defer server.Close()
+	ctx := context.Background()
+	client := NewClient(server.URL + "/")
+
+	major, err := client.MajorVersion(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if major != 2 {
+		t.Errorf("expected major version 2, got %d", major)
+	}
+
+	nodeNames, err := client.NodeNames(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeNames) != 2 {
+		t.Errorf("expected 2 cluster nodes, got %v", nodeNames)
+	}
+
+	stats, err := client.NodeStats(ctx, "node1@127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Couchdb.Httpd.Requests.Value != 620 {
+		t.Errorf("expected 620 requests, got %v", stats.Couchdb.Httpd.Requests.Value)
+	}
+
+	dbInfo, err := client.DatabaseInfo(ctx, "example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dbInfo.DiskSizeOverhead != 58570-3866 {
+		t.Errorf("expected the disk size overhead to be derived from the sizes, got %v", dbInfo.DiskSizeOverhead)
+	}
+
+	updateSeq, err := client.ViewUpdateSeq(ctx, "example", "_design/views", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updateSeq[:2] != "6-" {
+		t.Errorf("expected an opaque update sequence, got %s", updateSeq)
+	}
+}
+
+func TestClientActiveTasksV1(t *testing.T) {
+	server := testServer(t, map[string]string{
+		"/_active_tasks": "../testdata/active-tasks-v1.json",
+	})
+	defer server.Close()
+
+	activeTasks, err := NewClient(server.URL).ActiveTasks(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activeTasks) == 0 {
+		t.Fatal("expected active tasks")
+	}
+	for _, task := range activeTasks {
+		if task.Node != "master" {
+			t.Errorf("expected tasks without node to be assigned to master, got '%s'", task.Node)
+		}
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	server := testServer(t, map[string]string{
+		"/_scheduler/jobs": "../testdata/all-dbs.json",
+	})
+	defer server.Close()
+	ctx := context.Background()
+	client := NewClient(server.URL)
+
+	_, err := client.NodeStats(ctx, "missing@127.0.0.1")
+	var httpError *HttpError
+	if !errors.As(err, &httpError) || httpError.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an http error with status 404, got %v", err)
+	}
+
+	_, err = client.SchedulerJobs(ctx)
+	var decodeError *DecodeError
+	if !errors.As(err, &decodeError) || decodeError.Endpoint != "_scheduler/jobs" {
+		t.Errorf("expected a decode error for the scheduler jobs, got %v", err)
+	}
+}
+
+func TestParseUpdateSeq(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{`42`, "42"},
+		{`"6-g1AAAAFzeJzLYWBg"`, "6-g1AAAAFzeJzLYWBg"},
+	}
+	for _, test := range tests {
+		actual, err := ParseUpdateSeq(json.RawMessage(test.message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != test.expected {
+			t.Errorf("expected update sequence %s, got %s", test.expected, actual)
+		}
+	}
+	if _, err := ParseUpdateSeq(json.RawMessage(`{}`)); err == nil {
+		t.Error("expected an error for an invalid update sequence")
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	server := testServer(t, map[string]string{
+		"/_node/_local/_stats": "../testdata/couchdb-stats-response-v2.json",
+	})
+	defer server.Close()
+
+	stats, err := NewClient(server.URL).NodeStats(context.Background(), "_local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statistics, err := stats.Statistics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := make(map[string]Statistic)
+	for _, statistic := range statistics {
+		byPath[strings.Join(statistic.Path, ".")] = statistic
+	}
+
+	requests := byPath["couchdb.httpd.requests"]
+	if requests.Type != "counter" || requests.Value != 620 || requests.Desc == "" {
+		t.Errorf("expected the requests counter, got %+v", requests)
+	}
+	requestTime := byPath["couchdb.request_time"]
+	if requestTime.Type != "histogram" || requestTime.Histogram == nil || len(requestTime.Histogram.Percentile) != 6 {
+		t.Errorf("expected the request time histogram, got %+v", requestTime)
+	}
+	if _, ok := byPath["couch_replicator.checkpoints.success"]; !ok {
+		t.Errorf("expected the nested replicator checkpoints")
+	}
+	if len(statistics) != len(byPath) || len(statistics) < 100 {
+		t.Errorf("expected every statistic once, got %d", len(statistics))
+	}
+}
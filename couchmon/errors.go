@@ -0,0 +1,93 @@
+package couchmon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Common errors of CouchDB, to be checked with errors.Is
+var (
+	ErrNodeDown     = errors.New("nodedown")
+	ErrNotFound     = errors.New("not_found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrTimeout      = errors.New("timeout")
+	ErrNoMajority   = errors.New("no_majority")
+)
+
+var errorsByName = map[string]error{
+	"nodedown":     ErrNodeDown,
+	"not_found":    ErrNotFound,
+	"unauthorized": ErrUnauthorized,
+	"forbidden":    ErrForbidden,
+	"timeout":      ErrTimeout,
+	"no_majority":  ErrNoMajority,
+}
+
+var errorsByStatusCode = map[int]error{
+	http.StatusNotFound:       ErrNotFound,
+	http.StatusUnauthorized:   ErrUnauthorized,
+	http.StatusForbidden:      ErrForbidden,
+	http.StatusRequestTimeout: ErrTimeout,
+	http.StatusGatewayTimeout: ErrTimeout,
+}
+
+// HttpError is returned for responses of CouchDB with a status code other than 2xx or 3xx
+type HttpError struct {
+	Status     string
+	StatusCode int
+	RespBody   []byte
+	// ErrorName and Reason are decoded from CouchDB's {"error": ..., "reason": ...} response, if present
+	ErrorName string
+	Reason    string
+}
+
+// NewHttpError creates an HttpError, decoding CouchDB's error and reason from the response body
+func NewHttpError(status string, statusCode int, respBody []byte) *HttpError {
+	httpError := &HttpError{Status: status, StatusCode: statusCode, RespBody: respBody}
+	var errorResponse struct {
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(respBody, &errorResponse) == nil {
+		httpError.ErrorName = errorResponse.Error
+		httpError.Reason = errorResponse.Reason
+	}
+	return httpError
+}
+
+func (httpError *HttpError) Error() string {
+	return fmt.Errorf("status %s (%d): %s", httpError.Status, httpError.StatusCode, httpError.RespBody).Error()
+}
+
+// Is matches the common errors by CouchDB's error name or reason, or by the status code
+func (httpError *HttpError) Is(target error) bool {
+	if errorsByName[httpError.ErrorName] == target || errorsByName[httpError.Reason] == target {
+		return target != nil
+	}
+	return errorsByStatusCode[httpError.StatusCode] == target && target != nil
+}
+
+// Label returns CouchDB's error name for metric labels, or the status code if the body has no error name
+func (httpError *HttpError) Label() string {
+	if httpError.ErrorName != "" {
+		return httpError.ErrorName
+	}
+	return fmt.Sprintf("%d", httpError.StatusCode)
+}
+
+// DecodeError is returned when the response of an endpoint doesn't match the expected format
+type DecodeError struct {
+	Endpoint string
+	Err      error
+}
+
+func (decodeError *DecodeError) Error() string {
+	return fmt.Sprintf("error unmarshalling %s: %v", decodeError.Endpoint, decodeError.Err)
+}
+
+func (decodeError *DecodeError) Unwrap() error {
+	return decodeError.Err
+}
@@ -0,0 +1,41 @@
+package couchmon
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHttpErrorIs(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		expected   error
+		label      string
+	}{
+		{"nodedown", http.StatusInternalServerError, `{"error":"nodedown","reason":"progress not possible"}`, ErrNodeDown, "nodedown"},
+		{"not found by name", http.StatusNotFound, `{"error":"not_found","reason":"missing"}`, ErrNotFound, "not_found"},
+		{"not found by status", http.StatusNotFound, `not json`, ErrNotFound, "404"},
+		{"unauthorized", http.StatusUnauthorized, `{"error":"unauthorized","reason":"Name or password is incorrect."}`, ErrUnauthorized, "unauthorized"},
+		{"forbidden", http.StatusForbidden, `{"error":"forbidden","reason":"You are not a server admin."}`, ErrForbidden, "forbidden"},
+		{"timeout", http.StatusInternalServerError, `{"error":"timeout","reason":"The request could not be processed in a reasonable amount of time."}`, ErrTimeout, "timeout"},
+		{"no majority by reason", http.StatusInternalServerError, `{"error":"error","reason":"no_majority"}`, ErrNoMajority, "error"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			httpError := NewHttpError(fmt.Sprintf("%d", test.statusCode), test.statusCode, []byte(test.body))
+			err := fmt.Errorf("wrapped: %w", httpError)
+			if !errors.Is(err, test.expected) {
+				t.Errorf("expected %v to be %v", err, test.expected)
+			}
+			if errors.Is(err, ErrForbidden) != (test.expected == ErrForbidden) {
+				t.Errorf("expected %v not to be %v", err, ErrForbidden)
+			}
+			if httpError.Label() != test.label {
+				t.Errorf("expected label %s, got %s", test.label, httpError.Label())
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package couchmon
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Statistic is an entry of the _stats tree of CouchDB 2.x+, like couchdb.httpd.requests
+type Statistic struct {
+	// Path are the keys from the root of the tree to the entry, e.g. ["couchdb", "httpd", "requests"]
+	Path []string
+	// Type is "counter", "gauge" or "histogram"
+	Type string
+	Desc string
+	// Value of counters and gauges
+	Value float64
+	// Histogram is only set for histograms
+	Histogram *HistogramValue
+}
+
+// statisticEntry is a leaf of the _stats tree, the value depending on the type
+type statisticEntry struct {
+	Type  string          `json:"type"`
+	Desc  string          `json:"desc"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Statistics walks the _stats tree and returns all of its entries, ordered by their path.
+// Only available for responses of CouchDB 2.x+, which tell the type of each entry.
+func (s StatsResponse) Statistics() ([]Statistic, error) {
+	if s.raw == nil {
+		return nil, nil
+	}
+	var statistics []Statistic
+	err := walkStatistics(s.raw, nil, &statistics)
+	if err != nil {
+		return nil, &DecodeError{Endpoint: "_stats", Err: err}
+	}
+	return statistics, nil
+}
+
+func walkStatistics(data json.RawMessage, path []string, statistics *[]Statistic) error {
+	var tree map[string]json.RawMessage
+	if json.Unmarshal(data, &tree) != nil {
+		// neither an entry nor a section, e.g. a scalar of CouchDB 1.x
+		return nil
+	}
+	if _, ok := tree["type"]; ok {
+		if _, ok := tree["value"]; ok {
+			return appendStatistic(data, path, statistics)
+		}
+	}
+	keys := make([]string, 0, len(tree))
+	for key := range tree {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		err := walkStatistics(tree[key], append(path[:len(path):len(path)], key), statistics)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendStatistic(data json.RawMessage, path []string, statistics *[]Statistic) error {
+	var entry statisticEntry
+	err := json.Unmarshal(data, &entry)
+	if err != nil {
+		return err
+	}
+	statistic := Statistic{Path: path, Type: entry.Type, Desc: entry.Desc}
+	if entry.Type == "histogram" {
+		var histogram HistogramValue
+		err = json.Unmarshal(entry.Value, &histogram)
+		statistic.Histogram = &histogram
+	} else {
+		err = json.Unmarshal(entry.Value, &statistic.Value)
+	}
+	if err != nil {
+		return err
+	}
+	*statistics = append(*statistics, statistic)
+	return nil
+}
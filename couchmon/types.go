@@ -0,0 +1,398 @@
+package couchmon
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MembershipResponse is the response of _membership, or of _node/_local for a single node
+type MembershipResponse struct {
+	AllNodes     []string `json:"all_nodes"`
+	ClusterNodes []string `json:"cluster_nodes"`
+	SingleNode   string   `json:"name"`
+}
+
+type Counter struct {
+	// v1.x api
+	Description string
+	Current     float64
+	// v2.x api
+	Value float64
+	Type  string
+	Desc  string
+}
+
+type Percent map[int]float64
+
+// v2.x api
+type HistogramValue struct {
+	Min               float64     `json:"min"`
+	Max               float64     `json:"max"`
+	ArithmeticMean    float64     `json:"arithmetic_mean"`
+	GeometricMean     float64     `json:"geometric_mean"`
+	HarmonicMean      float64     `json:"harmonic_mean"`
+	Median            float64     `json:"median"`
+	Variance          float64     `json:"variance"`
+	StandardDeviation float64     `json:"standard_deviation"`
+	Skewness          float64     `json:"skewness"`
+	Kurtosis          float64     `json:"kurtosis"`
+	Percentile        [][]float64 `json:"percentile"`
+	N                 float64     `json:"n"`
+}
+
+type Histogram struct {
+	// v1.x api
+	Description string
+	Current     float64 `json:"current"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	Mean        float64 `json:"mean"`
+	Sum         float64 `json:"sum"`
+	Stddev      float64 `json:"stddev"`
+
+	// v2.x api
+	Value HistogramValue
+	Type  string
+	Desc  string
+}
+
+type CouchdbStats struct {
+	// v1.x, and v2.x api
+	AuthCacheHits   Counter   `json:"auth_cache_hits"`
+	AuthCacheMisses Counter   `json:"auth_cache_misses"`
+	DatabaseReads   Counter   `json:"database_reads"`
+	DatabaseWrites  Counter   `json:"database_writes"`
+	OpenDatabases   Counter   `json:"open_databases"`
+	OpenOsFiles     Counter   `json:"open_os_files"`
+	RequestTime     Histogram `json:"request_time"`
+	// v2.x api
+	Httpd               Httpd               `json:"httpd"`
+	HttpdRequestMethods HttpdRequestMethods `json:"httpd_request_methods"`
+	HttpdStatusCodes    HttpdStatusCodes    `json:"httpd_status_codes"`
+}
+
+type MangoStats struct {
+	UnindexedQueries   Counter   `json:"unindexed_queries"`
+	QueryInvalidIndex  Counter   `json:"query_invalid_index"`
+	TooManyDocs        Counter   `json:"too_many_docs_scanned"`
+	DocsExamined       Counter   `json:"docs_examined"`
+	QuorumDocsExamined Counter   `json:"quorum_docs_examined"`
+	ResultsReturned    Counter   `json:"results_returned"`
+	QueryTime          Histogram `json:"query_time"`
+	EvaluateSelector   Counter   `json:"evaluate_selector"`
+}
+
+// HttpdRequestMethods are the request counters by HTTP method, like "GET" or "OPTIONS"
+type HttpdRequestMethods map[string]Counter
+
+// HttpdStatusCodes are the response counters by HTTP status code, like "200" or "429"
+type HttpdStatusCodes map[string]Counter
+
+type Httpd struct {
+	BulkRequests             Counter `json:"bulk_requests"`
+	ClientsRequestingChanges Counter `json:"clients_requesting_changes"`
+	Requests                 Counter `json:"requests"`
+	TemporaryViewReads       Counter `json:"temporary_view_reads"`
+	ViewReads                Counter `json:"view_reads"`
+}
+
+type NodeFeatures []string
+
+type Vendor struct {
+	Name string `json:"name"`
+}
+
+// NodeInfo is the response of / (server info)
+type NodeInfo struct {
+	Couchdb  string       `json:"couchdb"`
+	Features NodeFeatures `json:"features"`
+	Vendor   Vendor       `json:"vendor"`
+	Version  string       `json:"version"`
+}
+
+// MajorVersion returns the major version, e.g. 1 for CouchDB 1.x
+func (n NodeInfo) MajorVersion() (int, error) {
+	major, err := strconv.Atoi(strings.Split(n.Version, ".")[0])
+	if err != nil {
+		return 0, &DecodeError{Endpoint: "version", Err: err}
+	}
+	return major, nil
+}
+
+// VersionAtLeast tells whether the version is at least major.minor, false for unknown versions
+func (n NodeInfo) VersionAtLeast(major int, minor int) bool {
+	actualMajor, err := n.MajorVersion()
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(n.Version, ".")
+	actualMinor := 0
+	if len(parts) > 1 {
+		actualMinor, _ = strconv.Atoi(parts[1])
+	}
+	return actualMajor > major || (actualMajor == major && actualMinor >= minor)
+}
+
+type ErlangVersion struct {
+	Version string `json:"version"`
+}
+
+type JavascriptEngine struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type CollationDriver struct {
+	Name            string `json:"name"`
+	LibraryVersion  string `json:"library_version"`
+	CollatorVersion string `json:"collator_version"`
+}
+
+// VersionsResponse is the response of _node/{node-name}/_versions (CouchDB 3.2+)
+type VersionsResponse struct {
+	Erlang           ErlangVersion    `json:"erlang"`
+	JavascriptEngine JavascriptEngine `json:"javascript_engine"`
+	CollationDriver  CollationDriver  `json:"collation_driver"`
+}
+
+type LogLevel struct {
+	Level map[string]Counter `json:"level"`
+}
+
+type Fabric struct {
+	Worker      map[string]Counter `json:"worker"`
+	OpenShard   map[string]Counter `json:"open_shard"`
+	ReadRepairs map[string]Counter `json:"read_repairs"`
+	DocUpdate   map[string]Counter `json:"doc_update"`
+}
+
+type CouchReplicator struct {
+	ChangesReadFailures  Counter            `json:"changes_read_failures"`
+	ChangesReaderDeaths  Counter            `json:"changes_reader_deaths"`
+	ChangesManagerDeaths Counter            `json:"changes_manager_deaths"`
+	ChangesQueueDeaths   Counter            `json:"changes_queue_deaths"`
+	Checkpoints          map[string]Counter `json:"checkpoints"`
+	FailedStarts         Counter            `json:"failed_starts"`
+	Requests             Counter            `json:"requests"`
+	Responses            map[string]Counter `json:"responses"`
+	StreamResponses      map[string]Counter `json:"stream_responses"`
+	WorkerDeaths         Counter            `json:"worker_deaths"`
+	WorkersStarted       Counter            `json:"workers_started"`
+	ClusterIsStable      Counter            `json:"cluster_is_stable"`
+	DbScans              Counter            `json:"db_scans"`
+	Docs                 map[string]Counter `json:"docs"`
+	Jobs                 map[string]Counter `json:"jobs"`
+	Connection           map[string]Counter `json:"connection"`
+}
+
+// StatsResponse is the response of _node/{node-name}/_stats (CouchDB 2.x+), or of _stats (CouchDB 1.x)
+type StatsResponse struct {
+	Couchdb CouchdbStats `json:"couchdb"`
+	Mango   MangoStats   `json:"mango"`
+	// v1.x api
+	Httpd               Httpd               `json:"httpd"`
+	HttpdRequestMethods HttpdRequestMethods `json:"httpd_request_methods"`
+	HttpdStatusCodes    HttpdStatusCodes    `json:"httpd_status_codes"`
+	// v2.x api
+	CouchLog        LogLevel        `json:"couch_log"`
+	Fabric          Fabric          `json:"fabric"`
+	CouchReplicator CouchReplicator `json:"couch_replicator"`
+
+	// raw is the whole response, to walk all statistics with Statistics
+	raw json.RawMessage
+}
+
+type View map[string]interface{}
+
+type Doc struct {
+	Id    string          `json:"_id"`
+	Views map[string]View `json:"views"`
+}
+
+type Row struct {
+	Id  string `json:"id"`
+	Doc Doc    `json:"doc"`
+}
+
+type Rows []Row
+
+// DocsResponse is the response of /{db}/_all_docs
+type DocsResponse struct {
+	Rows Rows `json:"rows"`
+}
+
+type ViewResponse struct {
+	UpdateSeq json.RawMessage `json:"update_seq"`
+	Error     string          `json:"error,omitempty"`
+	Reason    string          `json:"reason,omitempty"`
+}
+
+// v2.x api
+type DatabaseSizes struct {
+	Active   float64 `json:"active"`   // data_size
+	File     float64 `json:"file"`     // disk_size
+	External float64 `json:"external"` // uncompressed database content size
+}
+
+// v3.x api
+type DatabaseProps struct {
+	Partitioned bool `json:"partitioned"`
+}
+
+// DatabaseInfo is the response of /{db}, with the disk size overhead derived from the sizes
+type DatabaseInfo struct {
+	DataSize           float64       `json:"data_size"`
+	DiskSize           float64       `json:"disk_size"`
+	Sizes              DatabaseSizes `json:"sizes,omitempty"`
+	DiskSizeOverhead   float64
+	DocCount           float64 `json:"doc_count"`
+	DocDelCount        float64 `json:"doc_del_count"`
+	CompactRunningBool bool    `json:"compact_running"`
+	CompactRunning     float64
+	DiskFormatVersion  float64         `json:"disk_format_version"`
+	UpdateSeq          json.RawMessage `json:"update_seq"`
+	Props              DatabaseProps   `json:"props,omitempty"`
+}
+
+type ActiveTask struct {
+	Type           string  `json:"type"`
+	Node           string  `json:"node,omitempty"`
+	ChangesPending int     `json:"changes_pending,omitempty"`
+	Continuous     bool    `json:"continuous,omitempty"`
+	UpdatedOn      float64 `json:"updated_on,omitempty"`
+	Source         string  `json:"source,omitempty"`
+	Target         string  `json:"target,omitempty"`
+	DocId          string  `json:"doc_id,omitempty"`
+}
+
+// ActiveTasksResponse is the response of _active_tasks
+type ActiveTasksResponse []ActiveTask
+
+// SchedulerJobsResponse is the response of _scheduler/jobs (CouchDB 2.x+)
+type SchedulerJobsResponse struct {
+	TotalRows int `json:"total_rows"`
+	Offset    int `json:"offset"`
+	Jobs      []struct {
+		Database string `json:"database"`
+		ID       string `json:"id"`
+		Pid      string `json:"pid"`
+		Source   string `json:"source"`
+		Target   string `json:"target"`
+		User     string `json:"user"`
+		DocID    string `json:"doc_id"`
+		History  []struct {
+			Timestamp time.Time `json:"timestamp"`
+			Type      string    `json:"type"`
+		} `json:"history"`
+		Node      string    `json:"node"`
+		StartTime time.Time `json:"start_time"`
+	} `json:"jobs"`
+}
+
+type MemoryStats struct {
+	// v2.x api
+	Other         float64 `json:"other"`
+	Atom          float64 `json:"atom"`
+	AtomUsed      float64 `json:"atom_used"`
+	Processes     float64 `json:"processes"`
+	ProcessesUsed float64 `json:"processes_used"`
+	Binary        float64 `json:"binary"`
+	Code          float64 `json:"code"`
+	Ets           float64 `json:"ets"`
+	// Total is derived from the other values, if not reported
+	Total float64 `json:"total"`
+}
+
+// SystemResponse is the response of _node/{node-name}/_system (CouchDB 2.x+)
+type SystemResponse struct {
+	Uptime                  float64       `json:"uptime"`
+	MemoryStatsResponse     MemoryStats   `json:"memory"`
+	RunQueue                float64       `json:"run_queue"`
+	EtsTableCount           float64       `json:"ets_table_count"`
+	ContextSwitches         float64       `json:"context_switches"`
+	Reductions              float64       `json:"reductions"`
+	GarbageCollectionCount  float64       `json:"garbage_collection_count"`
+	WordsReclaimed          float64       `json:"words_reclaimed"`
+	IoInput                 float64       `json:"io_input"`
+	IoOutput                float64       `json:"io_output"`
+	OsProcCount             float64       `json:"os_proc_count"`
+	StaleProcCount          float64       `json:"stale_proc_count"`
+	ProcessCount            float64       `json:"process_count"`
+	ProcessLimit            float64       `json:"process_limit"`
+	InternalReplicationJobs float64       `json:"internal_replication_jobs"`
+	MessageQueues           MessageQueues `json:"message_queues"`
+	// Distribution has the stats of the connections to the other nodes by peer node name
+	Distribution map[string]DistributionStats `json:"distribution"`
+	// v3.x api, nil when not reported
+	RunQueueDirtyCpu *float64 `json:"run_queue_dirty_cpu"`
+}
+
+// DistributionStats are the socket stats of the Erlang distribution connection to a peer node, in bytes and packets
+type DistributionStats struct {
+	RecvOct  float64 `json:"recv_oct"`
+	RecvCnt  float64 `json:"recv_cnt"`
+	RecvMax  float64 `json:"recv_max"`
+	RecvAvg  float64 `json:"recv_avg"`
+	RecvDvi  float64 `json:"recv_dvi"`
+	SendOct  float64 `json:"send_oct"`
+	SendCnt  float64 `json:"send_cnt"`
+	SendMax  float64 `json:"send_max"`
+	SendAvg  float64 `json:"send_avg"`
+	SendPend float64 `json:"send_pend"`
+}
+
+// MessageQueues are the message queues by process name. Entries of unknown shapes are skipped,
+// so that they don't fail the whole _system response.
+type MessageQueues map[string]MessageQueue
+
+func (q *MessageQueues) UnmarshalJSON(data []byte) error {
+	var entries map[string]json.RawMessage
+	if json.Unmarshal(data, &entries) != nil {
+		*q = nil
+		return nil
+	}
+	queues := make(MessageQueues, len(entries))
+	for process, entry := range entries {
+		var queue MessageQueue
+		if json.Unmarshal(entry, &queue) == nil {
+			queues[process] = queue
+		}
+	}
+	*q = queues
+	return nil
+}
+
+// MessageQueue is the message queue length of a named process, or the summary of a process group
+// like couch_file, which CouchDB reports as {"count": ..., "min": ..., "max": ..., "50": ..., "90": ..., "99": ...}
+type MessageQueue struct {
+	// Length is the queue length of a named process, or the maximum queue length of a process group
+	Length float64
+	// Summary is nil for named processes
+	Summary *MessageQueueSummary
+}
+
+// MessageQueueSummary summarizes the message queue lengths of a process group
+type MessageQueueSummary struct {
+	Count  float64 `json:"count"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Median float64 `json:"50"`
+	P90    float64 `json:"90"`
+	P99    float64 `json:"99"`
+}
+
+func (q *MessageQueue) UnmarshalJSON(data []byte) error {
+	var length float64
+	if err := json.Unmarshal(data, &length); err == nil {
+		*q = MessageQueue{Length: length}
+		return nil
+	}
+	var summary MessageQueueSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return err
+	}
+	*q = MessageQueue{Length: summary.Max, Summary: &summary}
+	return nil
+}
@@ -0,0 +1,38 @@
+package couchmon
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessageQueueUnmarshal(t *testing.T) {
+	var queues map[string]MessageQueue
+	err := json.Unmarshal([]byte(`{"couch_server":7,"couch_file":{"count":3,"min":0,"max":12,"50":1,"90":10,"99":12}}`), &queues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server := queues["couch_server"]; server.Length != 7 || server.Summary != nil {
+		t.Errorf("expected the scalar queue length of a named process, got %+v", server)
+	}
+	file := queues["couch_file"]
+	if file.Length != 12 || file.Summary == nil || file.Summary.Count != 3 || file.Summary.P90 != 10 {
+		t.Errorf("expected the maximum queue length and the summary of a process group, got %+v", file)
+	}
+
+	if err := json.Unmarshal([]byte(`"invalid"`), &MessageQueue{}); err == nil {
+		t.Error("expected an error for an invalid message queue")
+	}
+
+	var system SystemResponse
+	err = json.Unmarshal([]byte(`{"uptime":42,"message_queues":{"couch_server":7,"unknown":"shape","other":[1,2]}}`), &system)
+	if err != nil {
+		t.Fatalf("expected message queues of unknown shapes to be skipped, got %v", err)
+	}
+	if len(system.MessageQueues) != 1 || system.MessageQueues["couch_server"].Length != 7 || system.Uptime != 42 {
+		t.Errorf("expected only the known message queues, got %+v", system)
+	}
+	err = json.Unmarshal([]byte(`{"uptime":42,"message_queues":"unknown"}`), &system)
+	if err != nil || system.MessageQueues != nil {
+		t.Errorf("expected an unknown shape of all message queues to be skipped, got %v, %v", err, system.MessageQueues)
+	}
+}
@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("active_tasks", defaultEnabled, newActiveTasksCollector)
+}
+
+// activeTasksCollector exports the running tasks by type and the replication progress from _active_tasks
+type activeTasksCollector struct {
+	logger *slog.Logger
+
+	activeTasks                          *prometheus.Desc
+	activeTasksDatabaseCompaction        *prometheus.Desc
+	activeTasksViewCompaction            *prometheus.Desc
+	activeTasksIndexer                   *prometheus.Desc
+	activeTasksReplication               *prometheus.Desc
+	activeTasksReplicationLastUpdate     *prometheus.Desc
+	activeTasksReplicationChangesPending *prometheus.Desc
+}
+
+func newActiveTasksCollector(d *metricDescs, logger *slog.Logger) Collector {
+	return &activeTasksCollector{
+		logger: logger,
+
+		activeTasks:                          d.newDesc(CollectorGroupStandard, "server", "active_tasks", "active tasks", "node_name"),
+		activeTasksDatabaseCompaction:        d.newDesc(CollectorGroupStandard, "server", "active_tasks_database_compaction", "active tasks database compaction", "node_name"),
+		activeTasksViewCompaction:            d.newDesc(CollectorGroupStandard, "server", "active_tasks_view_compaction", "active tasks view compaction", "node_name"),
+		activeTasksIndexer:                   d.newDesc(CollectorGroupStandard, "server", "active_tasks_indexer", "active tasks indexer", "node_name"),
+		activeTasksReplication:               d.newDesc(CollectorGroupStandard, "server", "active_tasks_replication", "active tasks replication", "node_name"),
+		activeTasksReplicationLastUpdate:     d.newDesc(CollectorGroupStandard, "server", "active_tasks_replication_updated_on", "active tasks replication updated on", "node_name", "doc_id", "continuous", "source", "target"),
+		activeTasksReplicationChangesPending: d.newDesc(CollectorGroupStandard, "server", "active_tasks_replication_changes_pending", "active tasks replication changes pending ", "node_name", "doc_id", "continuous", "source", "target"),
+	}
+}
+
+func (c *activeTasksCollector) Update(b *snapshotBuilder, stats Stats, config CollectorConfig) error {
+	activeTasksByNode := make(map[string]ActiveTaskTypes)
+	for _, task := range stats.ActiveTasksResponse {
+		if task.Type == "replication" {
+			b.set(c.activeTasksReplicationLastUpdate, task.UpdatedOn,
+				task.Node,
+				task.DocId,
+				strconv.FormatBool(task.Continuous),
+				task.Source,
+				task.Target)
+			b.set(c.activeTasksReplicationChangesPending, float64(task.ChangesPending),
+				task.Node,
+				task.DocId,
+				strconv.FormatBool(task.Continuous),
+				task.Source,
+				task.Target)
+		}
+
+		if _, ok := activeTasksByNode[task.Node]; !ok {
+			activeTasksByNode[task.Node] = ActiveTaskTypes{}
+		}
+		types := activeTasksByNode[task.Node]
+
+		switch taskType := task.Type; taskType {
+		case "database_compaction":
+			types.DatabaseCompaction++
+			types.Sum++
+		case "view_compaction":
+			types.ViewCompaction++
+			types.Sum++
+		case "indexer":
+			types.Indexer++
+			types.Sum++
+		case "replication":
+			types.Replication++
+			types.Sum++
+		default:
+			c.logger.Warn(fmt.Sprintf("unknown task type %s.", taskType))
+			types.Sum++
+		}
+		activeTasksByNode[task.Node] = types
+	}
+	for nodeName, tasks := range activeTasksByNode {
+		b.set(c.activeTasks, tasks.Sum, nodeName)
+		b.set(c.activeTasksDatabaseCompaction, tasks.DatabaseCompaction, nodeName)
+		b.set(c.activeTasksViewCompaction, tasks.ViewCompaction, nodeName)
+		b.set(c.activeTasksIndexer, tasks.Indexer, nodeName)
+		b.set(c.activeTasksReplication, tasks.Replication, nodeName)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package lib
+
+import (
+	"log/slog"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("databases", defaultEnabled, newDatabasesCollector)
+}
+
+// databasesCollector exports the total number of databases and the info of each observed database
+type databasesCollector struct {
+	databasesTotal *prometheus.Desc
+
+	dbInfo           *prometheus.Desc
+	diskSize         *prometheus.Desc
+	dataSize         *prometheus.Desc
+	docCount         *prometheus.Desc
+	docDelCount      *prometheus.Desc
+	compactRunning   *prometheus.Desc
+	diskSizeOverhead *prometheus.Desc
+}
+
+func newDatabasesCollector(d *metricDescs, logger *slog.Logger) Collector {
+	return &databasesCollector{
+		databasesTotal: d.newDesc(CollectorGroupStandard, "httpd", "databases_total", "Total number of databases in the cluster"),
+
+		dbInfo:           d.newDesc(CollectorGroupDatabases, "database", "info", "General info about a database.", "db_name", "disk_format_version", "partitioned"),
+		diskSize:         d.newDesc(CollectorGroupDatabases, "database", "disk_size", "disk size", "db_name"),
+		dataSize:         d.newDesc(CollectorGroupDatabases, "database", "data_size", "data size", "db_name"),
+		docCount:         d.newDesc(CollectorGroupDatabases, "database", "doc_count", "document count", "db_name"),
+		docDelCount:      d.newDesc(CollectorGroupDatabases, "database", "doc_del_count", "deleted document count", "db_name"),
+		compactRunning:   d.newDesc(CollectorGroupDatabases, "database", "compact_running", "database compaction running", "db_name"),
+		diskSizeOverhead: d.newDesc(CollectorGroupDatabases, "database", "overhead", "disk size overhead", "db_name"),
+	}
+}
+
+func (c *databasesCollector) Update(b *snapshotBuilder, stats Stats, config CollectorConfig) error {
+	b.set(c.databasesTotal, float64(stats.DatabasesTotal))
+
+	for _, dbName := range config.ObservedDatabases {
+		dbStats := stats.DatabaseStatsByDbName[dbName]
+		b.set(c.dbInfo, 1,
+			dbName,
+			strconv.FormatFloat(dbStats.DiskFormatVersion, 'G', -1, 32),
+			strconv.FormatBool(dbStats.Props.Partitioned))
+		// CouchDB 2.x+ moved the sizes into the "sizes" object
+		if dbStats.DiskSize == 0 && dbStats.Sizes.File > 0 {
+			b.set(c.diskSize, dbStats.Sizes.File, dbName)
+		} else {
+			b.set(c.diskSize, dbStats.DiskSize, dbName)
+		}
+		if dbStats.DataSize == 0 && dbStats.Sizes.Active > 0 {
+			b.set(c.dataSize, dbStats.Sizes.Active, dbName)
+		} else {
+			b.set(c.dataSize, dbStats.DataSize, dbName)
+		}
+		b.set(c.docCount, dbStats.DocCount, dbName)
+		b.set(c.docDelCount, dbStats.DocDelCount, dbName)
+		b.set(c.compactRunning, dbStats.CompactRunning, dbName)
+		b.set(c.diskSizeOverhead, dbStats.DiskSizeOverhead, dbName)
+	}
+	return nil
+}
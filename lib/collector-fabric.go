@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("fabric", defaultEnabled, newFabricCollector)
+}
+
+// fabricCollector exports the fabric stats of each node from _stats (CouchDB 2.x+)
+type fabricCollector struct {
+	fabricWorker      *prometheus.Desc
+	fabricOpenShard   *prometheus.Desc
+	fabricReadRepairs *prometheus.Desc
+	fabricDocUpdate   *prometheus.Desc
+}
+
+func newFabricCollector(d *metricDescs, logger *slog.Logger) Collector {
+	return &fabricCollector{
+		fabricWorker:      d.newCounterDesc(CollectorGroupStandard, "fabric", "worker", "worker metrics", "metric", "node_name"),
+		fabricOpenShard:   d.newCounterDesc(CollectorGroupStandard, "fabric", "open_shard", "open_shard metrics", "metric", "node_name"),
+		fabricReadRepairs: d.newCounterDesc(CollectorGroupStandard, "fabric", "read_repairs", "read repair metrics", "metric", "node_name"),
+		fabricDocUpdate:   d.newCounterDesc(CollectorGroupStandard, "fabric", "doc_update", "doc update metrics", "metric", "node_name"),
+	}
+}
+
+func (c *fabricCollector) Update(b *snapshotBuilder, stats Stats, config CollectorConfig) error {
+	if stats.ApiVersion != "2" {
+		return nil
+	}
+	for name, nodeStats := range stats.StatsByNodeName {
+		if nodeStats.Up == 0 {
+			continue
+		}
+		for _, metric := range exposedWorkerMetrics {
+			b.set(c.fabricWorker, nodeStats.Fabric.Worker[metric].Value, metric, name)
+		}
+
+		for _, metric := range exposedOpenShardMetrics {
+			b.set(c.fabricOpenShard, nodeStats.Fabric.OpenShard[metric].Value, metric, name)
+		}
+
+		for _, metric := range exposedExitState {
+			b.set(c.fabricReadRepairs, nodeStats.Fabric.ReadRepairs[metric].Value, metric, name)
+		}
+
+		for _, metric := range exposedDocUpdateMetrics {
+			b.set(c.fabricDocUpdate, nodeStats.Fabric.DocUpdate[metric].Value, metric, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("mango", defaultEnabled, newMangoCollector)
+}
+
+// mangoCollector exports the mango query stats of each node from _stats (CouchDB 2.x+)
+type mangoCollector struct {
+	mangoUnindexedQueries   *prometheus.Desc
+	mangoInvalidIndexes     *prometheus.Desc
+	mangoTooManyDocs        *prometheus.Desc
+	mangoDocsExamined       *prometheus.Desc
+	mangoQuorumDocsExamined *prometheus.Desc
+	mangoResultsReturned    *prometheus.Desc
+	mangoQueryTime          *prometheus.Desc
+	mangoQueryTimeSeconds   *histogramDescs
+	mangoEvaluateSelectors  *prometheus.Desc
+}
+
+func newMangoCollector(d *metricDescs, logger *slog.Logger) Collector {
+	return &mangoCollector{
+		mangoUnindexedQueries:   d.newCounterDesc(CollectorGroupStandard, "mango", "unindexed_queries", "number of mango queries that could not use an index", "node_name"),
+		mangoInvalidIndexes:     d.newCounterDesc(CollectorGroupStandard, "mango", "query_invalid_index", "number of mango queries that generated an invalid index warning", "node_name"),
+		mangoTooManyDocs:        d.newCounterDesc(CollectorGroupStandard, "mango", "too_many_docs_scanned", "number of mango queries that generated an index scan warning", "node_name"),
+		mangoDocsExamined:       d.newCounterDesc(CollectorGroupStandard, "mango", "docs_examined", "number of documents examined by mango queries coordinated by this node", "node_name"),
+		mangoQuorumDocsExamined: d.newCounterDesc(CollectorGroupStandard, "mango", "quorum_docs_examined", "number of documents examined by mango queries, using cluster quorum", "node_name"),
+		mangoResultsReturned:    d.newCounterDesc(CollectorGroupStandard, "mango", "results_returned", "number of rows returned by mango queries", "node_name"),
+		mangoQueryTime:          d.newDesc(CollectorGroupStandard, "mango", "query_time", "length of time processing a mango query", "node_name", "metric"),
+		mangoQueryTimeSeconds:   d.newHistogramDescs(CollectorGroupStandard, "mango", "query_time", "seconds", 0.001, "length of time processing a mango query", "node_name"),
+		mangoEvaluateSelectors:  d.newCounterDesc(CollectorGroupStandard, "mango", "evaluate_selector", "number of mango selector evaluations", "node_name"),
+	}
+}
+
+func (c *mangoCollector) Update(b *snapshotBuilder, stats Stats, config CollectorConfig) error {
+	if stats.ApiVersion != "2" {
+		return nil
+	}
+	for name, nodeStats := range stats.StatsByNodeName {
+		if nodeStats.Up == 0 {
+			continue
+		}
+		b.set(c.mangoUnindexedQueries, nodeStats.Mango.UnindexedQueries.Value, name)
+		b.set(c.mangoInvalidIndexes, nodeStats.Mango.QueryInvalidIndex.Value, name)
+		b.set(c.mangoTooManyDocs, nodeStats.Mango.TooManyDocs.Value, name)
+		b.set(c.mangoDocsExamined, nodeStats.Mango.DocsExamined.Value, name)
+		b.set(c.mangoQuorumDocsExamined, nodeStats.Mango.QuorumDocsExamined.Value, name)
+		b.set(c.mangoResultsReturned, nodeStats.Mango.ResultsReturned.Value, name)
+		b.set(c.mangoEvaluateSelectors, nodeStats.Mango.EvaluateSelector.Value, name)
+
+		b.set(c.mangoQueryTime, nodeStats.Mango.QueryTime.Value.Min, name, "Min")
+		b.set(c.mangoQueryTime, nodeStats.Mango.QueryTime.Value.Max, name, "Max")
+
+		b.set(c.mangoQueryTime, nodeStats.Mango.QueryTime.Value.ArithmeticMean, name, "ArithmeticMean")
+		b.set(c.mangoQueryTime, nodeStats.Mango.QueryTime.Value.GeometricMean, name, "GeometricMean")
+		b.set(c.mangoQueryTime, nodeStats.Mango.QueryTime.Value.HarmonicMean, name, "HarmonicMean")
+		b.set(c.mangoQueryTime, nodeStats.Mango.QueryTime.Value.Median, name, "Median")
+		b.set(c.mangoQueryTime, nodeStats.Mango.QueryTime.Value.Variance, name, "Variance")
+		b.set(c.mangoQueryTime, nodeStats.Mango.QueryTime.Value.StandardDeviation, name, "StandardDeviation")
+		b.set(c.mangoQueryTime, nodeStats.Mango.QueryTime.Value.Skewness, name, "Skewness")
+		b.set(c.mangoQueryTime, nodeStats.Mango.QueryTime.Value.Kurtosis, name, "Kurtosis")
+
+		for _, percentile := range nodeStats.Mango.QueryTime.Value.Percentile {
+			b.set(c.mangoQueryTime, percentile[1], name, fmt.Sprintf("%v", percentile[0]))
+		}
+		b.setHistogram(c.mangoQueryTimeSeconds, nodeStats.Mango.QueryTime.Value, name)
+	}
+	return nil
+}
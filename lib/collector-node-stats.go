@@ -0,0 +1,249 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("node_stats", defaultEnabled, newNodeStatsCollector)
+}
+
+// nodeStatsCollector exports the httpd and couchdb stats of each node from _stats
+type nodeStatsCollector struct {
+	nodeUp       *prometheus.Desc
+	nodeInfo     *prometheus.Desc
+	nodeVersions *prometheus.Desc
+	versionSkew  *prometheus.Desc
+
+	nodeReachable     *prometheus.Desc
+	nodeProbeDuration *prometheus.Desc
+
+	clusterNodes         *prometheus.Desc
+	clusterNodeConnected *prometheus.Desc
+	clusterNodeMember    *prometheus.Desc
+
+	authCacheHits   *prometheus.Desc
+	authCacheMisses *prometheus.Desc
+	databaseReads   *prometheus.Desc
+	databaseWrites  *prometheus.Desc
+	openDatabases   *prometheus.Desc
+	openOsFiles     *prometheus.Desc
+	requestTime     *prometheus.Desc
+	// requestTimeSeconds is only available for CouchDB 2.x+, which tells the percentiles
+	requestTimeSeconds *histogramDescs
+
+	httpdStatusCodes    *prometheus.Desc
+	httpdRequestMethods *prometheus.Desc
+
+	clientsRequestingChanges *prometheus.Desc
+	temporaryViewReads       *prometheus.Desc
+	requests                 *prometheus.Desc
+	bulkRequests             *prometheus.Desc
+	viewReads                *prometheus.Desc
+
+	couchLog *prometheus.Desc
+}
+
+func newNodeStatsCollector(d *metricDescs, logger *slog.Logger) Collector {
+	return &nodeStatsCollector{
+		nodeUp:       d.newDesc(CollectorGroupStandard, "httpd", "node_up", "Is the node available.", "node_name"),
+		nodeInfo:     d.newDesc(CollectorGroupStandard, "server", "node_info", "General info about a node.", "node_name", "version", "vendor_name"),
+		nodeVersions: d.newDesc(CollectorGroupStandard, "server", "node_versions", "Runtime versions of a node (CouchDB 3.2+).", "node_name", "erlang_version", "javascript_engine", "javascript_engine_version", "collator_version"),
+		versionSkew:  d.newDesc(CollectorGroupStandard, "cluster", "version_skew", "Number of distinct versions of a component across the nodes, more than 1 during a rolling upgrade.", "component"),
+
+		nodeReachable:     d.newDesc(CollectorGroupStandard, "node", "reachable", "Could the node be reached directly at its mapped URI.", "node_name"),
+		nodeProbeDuration: d.newDesc(CollectorGroupStandard, "node", "probe_duration_seconds", "Duration of the direct stats request to the node at its mapped URI.", "node_name"),
+
+		clusterNodes:         d.newDesc(CollectorGroupStandard, "cluster", "nodes", "Number of nodes in the all_nodes or cluster_nodes list of _membership.", "list"),
+		clusterNodeConnected: d.newDesc(CollectorGroupStandard, "cluster", "node_connected", "Is a configured node (cluster_nodes) connected (all_nodes).", "node_name"),
+		clusterNodeMember:    d.newDesc(CollectorGroupStandard, "cluster", "node_member", "Is a connected node (all_nodes) configured as member of the cluster (cluster_nodes).", "node_name"),
+
+		authCacheHits:      d.newCounterDesc(CollectorGroupStandard, "httpd", "auth_cache_hits", "number of authentication cache hits", "node_name"),
+		authCacheMisses:    d.newCounterDesc(CollectorGroupStandard, "httpd", "auth_cache_misses", "number of authentication cache misses", "node_name"),
+		databaseReads:      d.newCounterDesc(CollectorGroupStandard, "httpd", "database_reads", "number of times a document was read from a database", "node_name"),
+		databaseWrites:     d.newCounterDesc(CollectorGroupStandard, "httpd", "database_writes", "number of times a database was changed", "node_name"),
+		openDatabases:      d.newDesc(CollectorGroupStandard, "httpd", "open_databases", "number of open databases", "node_name"),
+		openOsFiles:        d.newDesc(CollectorGroupStandard, "httpd", "open_os_files", "number of file descriptors CouchDB has open", "node_name"),
+		requestTime:        d.newDesc(CollectorGroupStandard, "httpd", "request_time", "length of a request inside CouchDB without MochiWeb", "node_name", "metric"),
+		requestTimeSeconds: d.newHistogramDescs(CollectorGroupStandard, "httpd", "request_time", "seconds", 0.001, "length of a request inside CouchDB without MochiWeb", "node_name"),
+
+		httpdStatusCodes:    d.newCounterDesc(CollectorGroupStandard, "httpd", "status_codes", "number of HTTP responses by status code", "code", "node_name"),
+		httpdRequestMethods: d.newCounterDesc(CollectorGroupStandard, "httpd", "request_methods", "number of HTTP requests by method", "method", "node_name"),
+
+		clientsRequestingChanges: d.newDesc(CollectorGroupStandard, "httpd", "clients_requesting_changes", "number of clients for continuous _changes", "node_name"),
+		temporaryViewReads:       d.newCounterDesc(CollectorGroupStandard, "httpd", "temporary_view_reads", "number of temporary view reads", "node_name"),
+		requests:                 d.newCounterDesc(CollectorGroupStandard, "httpd", "requests", "number of HTTP requests", "node_name"),
+		bulkRequests:             d.newCounterDesc(CollectorGroupStandard, "httpd", "bulk_requests", "number of bulk requests", "node_name"),
+		viewReads:                d.newCounterDesc(CollectorGroupStandard, "httpd", "view_reads", "number of view reads", "node_name"),
+
+		couchLog: d.newCounterDesc(CollectorGroupStandard, "server", "couch_log", "number of messages logged by log level", "level", "node_name"),
+	}
+}
+
+func (c *nodeStatsCollector) Update(b *snapshotBuilder, stats Stats, config CollectorConfig) error {
+	// the skew of a component is only known when every node up told its version
+	upNodes := 0
+	versionsByComponent := make(map[string]map[string]bool)
+	nodesByComponent := make(map[string]int)
+	addVersion := func(component string, version string) {
+		if version == "" {
+			return
+		}
+		if _, ok := versionsByComponent[component]; !ok {
+			versionsByComponent[component] = make(map[string]bool)
+		}
+		versionsByComponent[component][version] = true
+		nodesByComponent[component]++
+	}
+	allowedStatusCodes := allowlist(config.HttpStatusCodes)
+	allowedRequestMethods := allowlist(config.HttpRequestMethods)
+	for name, nodeStats := range stats.StatsByNodeName {
+		b.set(c.nodeUp, nodeStats.Up, name)
+		if probe := nodeStats.Probe; probe != nil {
+			reachable := 0.0
+			if probe.Reachable {
+				reachable = 1
+			}
+			b.set(c.nodeReachable, reachable, name)
+			b.set(c.nodeProbeDuration, probe.Duration.Seconds(), name)
+		}
+		if nodeStats.Up == 0 {
+			continue
+		}
+		upNodes++
+		if nodeStats.NodeInfo.Version != "" {
+			b.set(c.nodeInfo, 1, name, nodeStats.NodeInfo.Version, nodeStats.NodeInfo.Vendor.Name)
+			addVersion("couchdb", nodeStats.NodeInfo.Version)
+		}
+		if versions := nodeStats.Versions; versions != nil {
+			b.set(c.nodeVersions, 1, name,
+				versions.Erlang.Version,
+				versions.JavascriptEngine.Name,
+				versions.JavascriptEngine.Version,
+				versions.CollationDriver.CollatorVersion)
+			addVersion("erlang", versions.Erlang.Version)
+			addVersion("javascript_engine", versions.JavascriptEngine.Name+" "+versions.JavascriptEngine.Version)
+			addVersion("collator", versions.CollationDriver.CollatorVersion)
+		}
+
+		if stats.ApiVersion == "2" {
+			c.updateV2(b, name, nodeStats)
+			c.updateHttpdCounters(b, c.httpdStatusCodes, nodeStats.Couchdb.HttpdStatusCodes, allowedStatusCodes, counterValue, name)
+			c.updateHttpdCounters(b, c.httpdRequestMethods, nodeStats.Couchdb.HttpdRequestMethods, allowedRequestMethods, counterValue, name)
+		} else {
+			c.updateV1(b, name, nodeStats)
+			c.updateHttpdCounters(b, c.httpdStatusCodes, nodeStats.HttpdStatusCodes, allowedStatusCodes, counterCurrent, name)
+			c.updateHttpdCounters(b, c.httpdRequestMethods, nodeStats.HttpdRequestMethods, allowedRequestMethods, counterCurrent, name)
+		}
+	}
+	for component, versions := range versionsByComponent {
+		if nodesByComponent[component] < upNodes {
+			continue
+		}
+		b.set(c.versionSkew, float64(len(versions)), component)
+	}
+	if stats.Membership != nil {
+		c.updateMembership(b, *stats.Membership)
+	}
+	return nil
+}
+
+// updateMembership compares the connected nodes (all_nodes) with the configured nodes (cluster_nodes),
+// which differ when a node is down or the cluster is split
+func (c *nodeStatsCollector) updateMembership(b *snapshotBuilder, membership MembershipResponse) {
+	b.set(c.clusterNodes, float64(len(membership.AllNodes)), "all_nodes")
+	b.set(c.clusterNodes, float64(len(membership.ClusterNodes)), "cluster_nodes")
+
+	connected := make(map[string]bool)
+	for _, name := range membership.AllNodes {
+		connected[name] = true
+	}
+	member := make(map[string]bool)
+	for _, name := range membership.ClusterNodes {
+		member[name] = true
+		isConnected := 0.0
+		if connected[name] {
+			isConnected = 1
+		}
+		b.set(c.clusterNodeConnected, isConnected, name)
+	}
+	for _, name := range membership.AllNodes {
+		isMember := 0.0
+		if member[name] {
+			isMember = 1
+		}
+		b.set(c.clusterNodeMember, isMember, name)
+	}
+}
+
+func counterCurrent(counter Counter) float64 {
+	return counter.Current
+}
+
+func counterValue(counter Counter) float64 {
+	return counter.Value
+}
+
+// updateHttpdCounters exports the counters of the status codes or request methods reported by CouchDB, limited to the allowed keys
+func (c *nodeStatsCollector) updateHttpdCounters(b *snapshotBuilder, desc *prometheus.Desc, counters map[string]Counter, allowed map[string]bool, value func(Counter) float64, name string) {
+	for key, counter := range counters {
+		if allowed != nil && !allowed[key] {
+			continue
+		}
+		b.set(desc, value(counter), key, name)
+	}
+}
+
+func (c *nodeStatsCollector) updateV1(b *snapshotBuilder, name string, nodeStats StatsResponse) {
+	b.set(c.authCacheHits, nodeStats.Couchdb.AuthCacheHits.Current, name)
+	b.set(c.authCacheMisses, nodeStats.Couchdb.AuthCacheMisses.Current, name)
+	b.set(c.databaseReads, nodeStats.Couchdb.DatabaseReads.Current, name)
+	b.set(c.databaseWrites, nodeStats.Couchdb.DatabaseWrites.Current, name)
+	b.set(c.openDatabases, nodeStats.Couchdb.OpenDatabases.Current, name)
+	b.set(c.openOsFiles, nodeStats.Couchdb.OpenOsFiles.Current, name)
+	b.set(c.requestTime, nodeStats.Couchdb.RequestTime.Current, name, "Current")
+
+	b.set(c.bulkRequests, nodeStats.Httpd.BulkRequests.Current, name)
+	b.set(c.clientsRequestingChanges, nodeStats.Httpd.ClientsRequestingChanges.Current, name)
+	b.set(c.requests, nodeStats.Httpd.Requests.Current, name)
+	b.set(c.temporaryViewReads, nodeStats.Httpd.TemporaryViewReads.Current, name)
+	b.set(c.viewReads, nodeStats.Httpd.ViewReads.Current, name)
+}
+
+func (c *nodeStatsCollector) updateV2(b *snapshotBuilder, name string, nodeStats StatsResponse) {
+	b.set(c.authCacheHits, nodeStats.Couchdb.AuthCacheHits.Value, name)
+	b.set(c.authCacheMisses, nodeStats.Couchdb.AuthCacheMisses.Value, name)
+	b.set(c.databaseReads, nodeStats.Couchdb.DatabaseReads.Value, name)
+	b.set(c.databaseWrites, nodeStats.Couchdb.DatabaseWrites.Value, name)
+	b.set(c.openDatabases, nodeStats.Couchdb.OpenDatabases.Value, name)
+	b.set(c.openOsFiles, nodeStats.Couchdb.OpenOsFiles.Value, name)
+
+	b.set(c.requestTime, nodeStats.Couchdb.RequestTime.Value.Min, name, "Min")
+	b.set(c.requestTime, nodeStats.Couchdb.RequestTime.Value.Max, name, "Max")
+	b.set(c.requestTime, nodeStats.Couchdb.RequestTime.Value.ArithmeticMean, name, "ArithmeticMean")
+	b.set(c.requestTime, nodeStats.Couchdb.RequestTime.Value.GeometricMean, name, "GeometricMean")
+	b.set(c.requestTime, nodeStats.Couchdb.RequestTime.Value.HarmonicMean, name, "HarmonicMean")
+	b.set(c.requestTime, nodeStats.Couchdb.RequestTime.Value.Median, name, "Median")
+	b.set(c.requestTime, nodeStats.Couchdb.RequestTime.Value.Variance, name, "Variance")
+	b.set(c.requestTime, nodeStats.Couchdb.RequestTime.Value.StandardDeviation, name, "StandardDeviation")
+	b.set(c.requestTime, nodeStats.Couchdb.RequestTime.Value.Skewness, name, "Skewness")
+	b.set(c.requestTime, nodeStats.Couchdb.RequestTime.Value.Kurtosis, name, "Kurtosis")
+
+	for _, percentile := range nodeStats.Couchdb.RequestTime.Value.Percentile {
+		b.set(c.requestTime, percentile[1], name, fmt.Sprintf("%v", percentile[0]))
+	}
+	b.setHistogram(c.requestTimeSeconds, nodeStats.Couchdb.RequestTime.Value, name)
+
+	for _, level := range exposedLogLevels {
+		b.set(c.couchLog, nodeStats.CouchLog.Level[level].Value, level, name)
+	}
+
+	b.set(c.bulkRequests, nodeStats.Couchdb.Httpd.BulkRequests.Value, name)
+	b.set(c.clientsRequestingChanges, nodeStats.Couchdb.Httpd.ClientsRequestingChanges.Value, name)
+	b.set(c.requests, nodeStats.Couchdb.Httpd.Requests.Value, name)
+	b.set(c.temporaryViewReads, nodeStats.Couchdb.Httpd.TemporaryViewReads.Value, name)
+	b.set(c.viewReads, nodeStats.Couchdb.Httpd.ViewReads.Value, name)
+}
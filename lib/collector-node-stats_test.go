@@ -0,0 +1,289 @@
+package lib
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newCouchdbServer serves the JSON responses by path, and CouchDB's not_found error for other paths.
+// Error responses like {"error":"nodedown",...} are served with status 500.
+func newCouchdbServer(responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			response = `{"error":"not_found","reason":"missing"}`
+		} else if strings.HasPrefix(response, `{"error":`) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = w.Write([]byte(response))
+	}))
+}
+
+// onlyCollectors enables the named collectors and disables all others
+func onlyCollectors(names ...string) map[string]bool {
+	collectors := make(map[string]bool)
+	for _, name := range CollectorNames() {
+		collectors[name] = false
+	}
+	for _, name := range names {
+		collectors[name] = true
+	}
+	return collectors
+}
+
+// scrapeWith scrapes a CouchDB server serving the responses by path, see newCouchdbServer
+func scrapeWith(t *testing.T, responses map[string]string, config CollectorConfig) (*metricsSnapshot, *Exporter) {
+	server := newCouchdbServer(responses)
+	defer server.Close()
+
+	e := newExporter(newOptions(WithURI(server.URL), WithCollectorConfig(config)))
+	snapshot, err := e.scrape()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snapshot, e
+}
+
+// snapshotValues returns the values of a metric in the snapshot by their label values, joined with ","
+func snapshotValues(t *testing.T, snapshot *metricsSnapshot, desc *prometheus.Desc) map[string]float64 {
+	values := make(map[string]float64)
+	for _, metric := range snapshot.metrics {
+		if metric.Desc() != desc {
+			continue
+		}
+		var m dto.Metric
+		err := metric.Write(&m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var labelValues []string
+		for _, label := range m.GetLabel() {
+			labelValues = append(labelValues, label.GetName()+"="+label.GetValue())
+		}
+		if m.GetCounter() != nil {
+			values[strings.Join(labelValues, ",")] = m.GetCounter().GetValue()
+		} else {
+			values[strings.Join(labelValues, ",")] = m.GetGauge().GetValue()
+		}
+	}
+	return values
+}
+
+func TestNodeInfoAndVersionSkew(t *testing.T) {
+	snapshot, e := scrapeWith(t, map[string]string{
+		"/":                        `{"couchdb":"Welcome","version":"3.3.2","vendor":{"name":"The Apache Software Foundation"}}`,
+		"/_membership":             `{"all_nodes":["node1@a","node2@b"],"cluster_nodes":["node1@a","node2@b"]}`,
+		"/_node/node1@a/":          `{"couchdb":"Welcome","version":"3.3.2","vendor":{"name":"The Apache Software Foundation"}}`,
+		"/_node/node1@a/_stats":    `{}`,
+		"/_node/node2@b/_stats":    `{}`,
+		"/_node/node1@a/_versions": `{"erlang":{"version":"24.3.4"},"javascript_engine":{"name":"spidermonkey","version":"91"},"collation_driver":{"name":"libicu","collator_version":"153.112"}}`,
+		"/_node/node2@b/_versions": `{"erlang":{"version":"25.3.2"},"javascript_engine":{"name":"spidermonkey","version":"91"},"collation_driver":{"name":"libicu","collator_version":"153.112"}}`,
+	}, CollectorConfig{
+		Collectors: onlyCollectors("node_stats"),
+	})
+	c := e.collectors["node_stats"].(*nodeStatsCollector)
+
+	nodeInfo := snapshotValues(t, snapshot, c.nodeInfo)
+	if _, ok := nodeInfo["node_name=node1@a,vendor_name=The Apache Software Foundation,version=3.3.2"]; !ok {
+		t.Errorf("expected the server info of node1@a, got %v", nodeInfo)
+	}
+	if len(nodeInfo) != 1 {
+		t.Errorf("expected no server info for node2@b not answering it, got %v", nodeInfo)
+	}
+
+	skew := snapshotValues(t, snapshot, c.versionSkew)
+	if value, ok := skew["component=couchdb"]; ok {
+		t.Errorf("expected no couchdb version skew while the version of node2@b is unknown, got %v", value)
+	}
+	expected := map[string]float64{
+		"component=erlang":            2,
+		"component=javascript_engine": 1,
+		"component=collator":          1,
+	}
+	for labels, value := range expected {
+		if skew[labels] != value {
+			t.Errorf("expected %s version skew %v, got %v", labels, value, skew[labels])
+		}
+	}
+}
+
+func TestNodeInfoOfDirectNodes(t *testing.T) {
+	node1 := newCouchdbServer(map[string]string{
+		"/":                    `{"couchdb":"Welcome","version":"3.3.2","vendor":{"name":"The Apache Software Foundation"}}`,
+		"/_membership":         `{"all_nodes":["node1@a","node2@b"],"cluster_nodes":["node1@a","node2@b"]}`,
+		"/_node/_local/_stats": `{}`,
+	})
+	defer node1.Close()
+	node2 := newCouchdbServer(map[string]string{
+		"/":                    `{"couchdb":"Welcome","version":"3.4.1","vendor":{"name":"The Apache Software Foundation"}}`,
+		"/_node/_local/_stats": `{}`,
+	})
+	defer node2.Close()
+
+	e := newExporter(newOptions(WithURI(node1.URL), WithCollectorConfig(CollectorConfig{
+		Collectors: onlyCollectors("node_stats"),
+		NodeUris:   NodeUris{Static: map[string]string{"node1@a": node1.URL, "node2@b": node2.URL}},
+	})))
+	snapshot, err := e.scrape()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := e.collectors["node_stats"].(*nodeStatsCollector)
+
+	nodeInfo := snapshotValues(t, snapshot, c.nodeInfo)
+	for _, labels := range []string{
+		"node_name=node1@a,vendor_name=The Apache Software Foundation,version=3.3.2",
+		"node_name=node2@b,vendor_name=The Apache Software Foundation,version=3.4.1",
+	} {
+		if _, ok := nodeInfo[labels]; !ok {
+			t.Errorf("expected the server info %s, got %v", labels, nodeInfo)
+		}
+	}
+	if skew := snapshotValues(t, snapshot, c.versionSkew)["component=couchdb"]; skew != 2 {
+		t.Errorf("expected a couchdb version skew of 2 during the rolling upgrade, got %v", skew)
+	}
+}
+
+func TestDownNodesAndMembership(t *testing.T) {
+	snapshot, e := scrapeWith(t, map[string]string{
+		"/":                     `{"couchdb":"Welcome","version":"3.1.2"}`,
+		"/_membership":          `{"all_nodes":["node1@a","node3@c"],"cluster_nodes":["node1@a","node2@b"]}`,
+		"/_node/node1@a/_stats": `{}`,
+		"/_node/node2@b/_stats": `{"error":"nodedown","reason":"progress not possible"}`,
+	}, CollectorConfig{
+		Collectors: onlyCollectors("node_stats", "fabric"),
+	})
+	c := e.collectors["node_stats"].(*nodeStatsCollector)
+
+	tests := []struct {
+		desc     *prometheus.Desc
+		expected map[string]float64
+	}{
+		{c.nodeUp, map[string]float64{"node_name=node1@a": 1, "node_name=node2@b": 0}},
+		{c.clusterNodes, map[string]float64{"list=all_nodes": 2, "list=cluster_nodes": 2}},
+		{c.clusterNodeConnected, map[string]float64{"node_name=node1@a": 1, "node_name=node2@b": 0}},
+		{c.clusterNodeMember, map[string]float64{"node_name=node1@a": 1, "node_name=node3@c": 0}},
+	}
+	for _, test := range tests {
+		actual := snapshotValues(t, snapshot, test.desc)
+		if len(actual) != len(test.expected) {
+			t.Errorf("expected %v, got %v", test.expected, actual)
+		}
+		for labels, value := range test.expected {
+			if v, ok := actual[labels]; !ok || v != value {
+				t.Errorf("expected %s %v for %s, got %v", labels, value, test.desc, actual)
+			}
+		}
+	}
+
+	fabric := e.collectors["fabric"].(*fabricCollector)
+	for labels := range snapshotValues(t, snapshot, fabric.fabricWorker) {
+		if strings.Contains(labels, "node2@b") {
+			t.Errorf("expected no fabric metrics for the down node, got %s", labels)
+		}
+	}
+}
+
+func TestDirectNodeScrapingWhileCoordinatorDown(t *testing.T) {
+	coordinator := newCouchdbServer(map[string]string{})
+	coordinator.Close()
+	node1 := newCouchdbServer(map[string]string{
+		"/":                    `{"couchdb":"Welcome","version":"3.1.2"}`,
+		"/_node/_local/_stats": `{}`,
+	})
+	defer node1.Close()
+	node2 := newCouchdbServer(map[string]string{})
+	node2.Close()
+
+	e := newExporter(newOptions(WithURI(coordinator.URL), WithCollectorConfig(CollectorConfig{
+		Collectors: onlyCollectors("node_stats"),
+		NodeUris:   NodeUris{Static: map[string]string{"node1@a": node1.URL, "node2@b": node2.URL}},
+	})))
+	snapshot, err := e.scrape()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := e.collectors["node_stats"].(*nodeStatsCollector)
+
+	tests := []struct {
+		desc     *prometheus.Desc
+		expected map[string]float64
+	}{
+		{c.nodeUp, map[string]float64{"node_name=node1@a": 1, "node_name=node2@b": 0}},
+		{c.nodeReachable, map[string]float64{"node_name=node1@a": 1, "node_name=node2@b": 0}},
+	}
+	for _, test := range tests {
+		actual := snapshotValues(t, snapshot, test.desc)
+		for labels, value := range test.expected {
+			if v, ok := actual[labels]; !ok || v != value {
+				t.Errorf("expected %s %v for %s, got %v", labels, value, test.desc, actual)
+			}
+		}
+	}
+	if len(snapshotValues(t, snapshot, c.nodeProbeDuration)) != 2 {
+		t.Errorf("expected the probe duration of both nodes")
+	}
+	if _, ok := snapshotValues(t, snapshot, c.nodeInfo)["node_name=node1@a,vendor_name=,version=3.1.2"]; !ok {
+		t.Errorf("expected the server info of the node answering instead of the coordinator")
+	}
+}
+
+func TestHttpdStatusCodesAndRequestMethods(t *testing.T) {
+	responses := map[string]string{
+		"/":                        `{"couchdb":"Welcome","version":"3.3.2"}`,
+		"/_membership":             `{"all_nodes":["node1@a"],"cluster_nodes":["node1@a"]}`,
+		"/_node/node1@a/_versions": `{}`,
+		"/_node/node1@a/_stats": `{"couchdb":{
+			"httpd_status_codes":{"200":{"value":10,"type":"counter"},"413":{"value":1,"type":"counter"},"429":{"value":2,"type":"counter"},"503":{"value":3,"type":"counter"}},
+			"httpd_request_methods":{"GET":{"value":7,"type":"counter"},"OPTIONS":{"value":4,"type":"counter"}}}}`,
+	}
+
+	tests := []struct {
+		config          CollectorConfig
+		expectedCodes   map[string]float64
+		expectedMethods map[string]float64
+	}{
+		{
+			config: CollectorConfig{},
+			expectedCodes: map[string]float64{
+				"code=200,node_name=node1@a": 10,
+				"code=413,node_name=node1@a": 1,
+				"code=429,node_name=node1@a": 2,
+				"code=503,node_name=node1@a": 3,
+			},
+			expectedMethods: map[string]float64{
+				"method=GET,node_name=node1@a":     7,
+				"method=OPTIONS,node_name=node1@a": 4,
+			},
+		},
+		{
+			config: CollectorConfig{HttpStatusCodes: []string{"429", "503", "504"}, HttpRequestMethods: []string{"OPTIONS"}},
+			expectedCodes: map[string]float64{
+				"code=429,node_name=node1@a": 2,
+				"code=503,node_name=node1@a": 3,
+			},
+			expectedMethods: map[string]float64{
+				"method=OPTIONS,node_name=node1@a": 4,
+			},
+		},
+	}
+	for _, test := range tests {
+		test.config.Collectors = onlyCollectors("node_stats")
+		snapshot, e := scrapeWith(t, responses, test.config)
+		c := e.collectors["node_stats"].(*nodeStatsCollector)
+
+		if codes := snapshotValues(t, snapshot, c.httpdStatusCodes); !reflect.DeepEqual(codes, test.expectedCodes) {
+			t.Errorf("expected the status codes %v, got %v", test.expectedCodes, codes)
+		}
+		if methods := snapshotValues(t, snapshot, c.httpdRequestMethods); !reflect.DeepEqual(methods, test.expectedMethods) {
+			t.Errorf("expected the request methods %v, got %v", test.expectedMethods, methods)
+		}
+	}
+}
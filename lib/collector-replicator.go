@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("replicator", defaultEnabled, newReplicatorCollector)
+}
+
+// replicatorCollector exports the couch_replicator stats of each node from _stats (CouchDB 2.x+)
+type replicatorCollector struct {
+	couchReplicatorChangesReadFailures  *prometheus.Desc
+	couchReplicatorChangesReaderDeaths  *prometheus.Desc
+	couchReplicatorChangesManagerDeaths *prometheus.Desc
+	couchReplicatorChangesQueueDeaths   *prometheus.Desc
+	couchReplicatorCheckpoints          *prometheus.Desc
+	couchReplicatorFailedStarts         *prometheus.Desc
+	couchReplicatorRequests             *prometheus.Desc
+	couchReplicatorResponses            *prometheus.Desc
+	couchReplicatorStreamResponses      *prometheus.Desc
+	couchReplicatorWorkerDeaths         *prometheus.Desc
+	couchReplicatorWorkersStarted       *prometheus.Desc
+	couchReplicatorClusterIsStable      *prometheus.Desc
+	couchReplicatorDbScans              *prometheus.Desc
+	couchReplicatorDocs                 *prometheus.Desc
+	couchReplicatorJobs                 *prometheus.Desc
+	couchReplicatorConnection           *prometheus.Desc
+}
+
+func newReplicatorCollector(d *metricDescs, logger *slog.Logger) Collector {
+	return &replicatorCollector{
+		couchReplicatorChangesReadFailures:  d.newCounterDesc(CollectorGroupStandard, "replicator", "changes_read_failures", "number of failed replicator changes read failures", "node_name"),
+		couchReplicatorChangesReaderDeaths:  d.newCounterDesc(CollectorGroupStandard, "replicator", "changes_reader_deaths", "number of failed replicator changes readers", "node_name"),
+		couchReplicatorChangesManagerDeaths: d.newCounterDesc(CollectorGroupStandard, "replicator", "changes_manager_deaths", "number of failed replicator changes managers", "node_name"),
+		couchReplicatorChangesQueueDeaths:   d.newCounterDesc(CollectorGroupStandard, "replicator", "changes_queue_deaths", "number of failed replicator changes work queues", "node_name"),
+		couchReplicatorCheckpoints:          d.newCounterDesc(CollectorGroupStandard, "replicator", "checkpoints", "replicator checkpoint counters", "metric", "node_name"),
+		couchReplicatorFailedStarts:         d.newCounterDesc(CollectorGroupStandard, "replicator", "failed_starts", "number of replications that have failed to start", "node_name"),
+		couchReplicatorRequests:             d.newCounterDesc(CollectorGroupStandard, "replicator", "requests", "number of HTTP requests made by the replicator", "node_name"),
+		couchReplicatorResponses:            d.newCounterDesc(CollectorGroupStandard, "replicator", "responses", "number of HTTP responses by state", "metric", "node_name"),
+		couchReplicatorStreamResponses:      d.newCounterDesc(CollectorGroupStandard, "replicator", "stream_responses", "number of streaming HTTP responses by state", "metric", "node_name"),
+		couchReplicatorWorkerDeaths:         d.newCounterDesc(CollectorGroupStandard, "replicator", "worker_deaths", "number of failed replicator workers", "node_name"),
+		couchReplicatorWorkersStarted:       d.newCounterDesc(CollectorGroupStandard, "replicator", "workers_started", "number of replicator workers started", "node_name"),
+		couchReplicatorClusterIsStable:      d.newDesc(CollectorGroupStandard, "replicator", "cluster_is_stable", "1 if cluster is stable, 0 if unstable", "node_name"),
+		couchReplicatorDbScans:              d.newCounterDesc(CollectorGroupStandard, "replicator", "db_scans", "number of times replicator db scans have been started", "node_name"),
+		couchReplicatorDocs:                 d.newCounterDesc(CollectorGroupStandard, "replicator", "docs", "replicator metrics shown by type", "metric", "node_name"),
+		couchReplicatorJobs:                 d.newDesc(CollectorGroupStandard, "replicator", "jobs", "replicator jobs shown by type", "metric", "node_name"),
+		couchReplicatorConnection:           d.newCounterDesc(CollectorGroupStandard, "replicator", "connections", "replicator connection metrics shown by type", "metric", "node_name"),
+	}
+}
+
+func (c *replicatorCollector) Update(b *snapshotBuilder, stats Stats, config CollectorConfig) error {
+	if stats.ApiVersion != "2" {
+		return nil
+	}
+	for name, nodeStats := range stats.StatsByNodeName {
+		if nodeStats.Up == 0 {
+			continue
+		}
+		b.set(c.couchReplicatorChangesReadFailures, nodeStats.CouchReplicator.ChangesReadFailures.Value, name)
+		b.set(c.couchReplicatorChangesReaderDeaths, nodeStats.CouchReplicator.ChangesReaderDeaths.Value, name)
+		b.set(c.couchReplicatorChangesManagerDeaths, nodeStats.CouchReplicator.ChangesManagerDeaths.Value, name)
+		b.set(c.couchReplicatorChangesQueueDeaths, nodeStats.CouchReplicator.ChangesQueueDeaths.Value, name)
+		for _, metric := range exposedExitState {
+			b.set(c.couchReplicatorCheckpoints, nodeStats.CouchReplicator.Checkpoints[metric].Value, metric, name)
+		}
+		b.set(c.couchReplicatorFailedStarts, nodeStats.CouchReplicator.FailedStarts.Value, name)
+		b.set(c.couchReplicatorRequests, nodeStats.CouchReplicator.Requests.Value, name)
+		for _, metric := range exposedExitState {
+			b.set(c.couchReplicatorResponses, nodeStats.CouchReplicator.Responses[metric].Value, metric, name)
+		}
+		for _, metric := range exposedExitState {
+			b.set(c.couchReplicatorStreamResponses, nodeStats.CouchReplicator.StreamResponses[metric].Value, metric, name)
+		}
+		b.set(c.couchReplicatorWorkerDeaths, nodeStats.CouchReplicator.WorkerDeaths.Value, name)
+		b.set(c.couchReplicatorWorkersStarted, nodeStats.CouchReplicator.WorkersStarted.Value, name)
+		b.set(c.couchReplicatorClusterIsStable, nodeStats.CouchReplicator.ClusterIsStable.Value, name)
+		b.set(c.couchReplicatorDbScans, nodeStats.CouchReplicator.DbScans.Value, name)
+		for _, metric := range exposedReplicatorDocs {
+			b.set(c.couchReplicatorDocs, nodeStats.CouchReplicator.Docs[metric].Value, metric, name)
+		}
+		for _, metric := range exposedReplicatorJobs {
+			b.set(c.couchReplicatorJobs, nodeStats.CouchReplicator.Jobs[metric].Value, metric, name)
+		}
+		for _, metric := range exposedReplicatorConnection {
+			b.set(c.couchReplicatorConnection, nodeStats.CouchReplicator.Connection[metric].Value, metric, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package lib
+
+import (
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("scheduler", defaultDisabled, newSchedulerCollector)
+}
+
+// schedulerCollector exports the replication jobs from _scheduler/jobs (CouchDB 2.x+)
+type schedulerCollector struct {
+	schedulerJobs *prometheus.Desc
+}
+
+func newSchedulerCollector(d *metricDescs, logger *slog.Logger) Collector {
+	return &schedulerCollector{
+		schedulerJobs: d.newDesc(CollectorGroupScheduler, "scheduler", "jobs", "scheduler jobs", "node_name", "job_id", "db_name", "doc_id", "source", "target"),
+	}
+}
+
+func (c *schedulerCollector) Update(b *snapshotBuilder, stats Stats, config CollectorConfig) error {
+	for _, job := range stats.SchedulerJobsResponse.Jobs {
+		b.set(c.schedulerJobs, float64(len(job.History)),
+			job.Node,
+			job.ID,
+			job.Database,
+			job.DocID,
+			job.Source,
+			job.Target)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("stats", defaultDisabled, newStatsCollector)
+}
+
+// statsCollector exports every statistic of _stats (CouchDB 2.x+), named after its path like couchdb_stats_couchdb_httpd_requests_total.
+// Counters and gauges are exported as told by the type of each statistic, histograms as summaries and gauges of their statistics.
+// The curated metrics of the other collectors are kept as they are.
+type statsCollector struct {
+	d      *metricDescs
+	logger *slog.Logger
+
+	describeOnce sync.Once
+
+	mu         sync.Mutex
+	descs      map[string]*prometheus.Desc
+	histograms map[string]*histogramDescs
+	// fixed is set once the descriptions were derived for a registry, which only accepts the described metrics.
+	// Statistics unknown at that time are skipped.
+	fixed bool
+}
+
+func newStatsCollector(d *metricDescs, logger *slog.Logger) Collector {
+	return &statsCollector{
+		d:          d,
+		logger:     logger,
+		descs:      make(map[string]*prometheus.Desc),
+		histograms: make(map[string]*histogramDescs),
+	}
+}
+
+func (c *statsCollector) Update(b *snapshotBuilder, stats Stats, config CollectorConfig) error {
+	if stats.ApiVersion != "2" {
+		return nil
+	}
+	for name, nodeStats := range stats.StatsByNodeName {
+		if nodeStats.Up == 0 {
+			continue
+		}
+		statistics, err := nodeStats.Statistics()
+		if err != nil {
+			c.logger.Warn(fmt.Sprintf("error walking the stats of node %s: %v", name, err))
+			continue
+		}
+		for _, statistic := range statistics {
+			switch statistic.Type {
+			case "counter":
+				if desc := c.desc(statistic.Path, "total", statistic.Desc); desc != nil {
+					b.setCounter(desc, statistic.Value, name)
+				}
+			case "gauge":
+				if desc := c.desc(statistic.Path, "", statistic.Desc); desc != nil {
+					b.set(desc, statistic.Value, name)
+				}
+			case "histogram":
+				if histogram := c.histogramDescs(statistic.Path, statistic.Desc); histogram != nil {
+					b.setHistogram(histogram, *statistic.Histogram, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// describe derives the descriptions from the stats of the nodes, and fixes them if any node answered.
+// Otherwise the descriptions are still created on first use.
+func (c *statsCollector) describe(b *snapshotBuilder, stats Stats, config CollectorConfig) {
+	if err := c.Update(b, stats, config); err != nil {
+		c.logger.Warn(fmt.Sprintf("error deriving the stats metrics: %v", err))
+		return
+	}
+	for _, nodeStats := range stats.StatsByNodeName {
+		if nodeStats.Up == 1 {
+			c.mu.Lock()
+			c.fixed = true
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+// desc returns the description of a statistic, created on first use unless the descriptions are fixed
+func (c *statsCollector) desc(path []string, suffix string, help string) *prometheus.Desc {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.descByName(statisticName(path, suffix), statisticHelp(path, help))
+}
+
+// histogramDescs returns the descriptions of a histogram statistic, created on first use unless the descriptions are fixed.
+// The unit of the histograms is unknown, so that their values are exported as they are.
+func (c *statsCollector) histogramDescs(path []string, help string) *histogramDescs {
+	name := statisticName(path, "")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if histogram, ok := c.histograms[name]; ok {
+		return histogram
+	}
+	if c.fixed {
+		return nil
+	}
+	histogram := newHistogramDescs(func(suffix string, help string) *prometheus.Desc {
+		return c.descByName(name+suffix, help)
+	}, "", 1, statisticHelp(path, help))
+	c.histograms[name] = histogram
+	return histogram
+}
+
+// descByName returns the description of a metric, created on first use. The caller has to hold the lock.
+func (c *statsCollector) descByName(name string, help string) *prometheus.Desc {
+	if desc, ok := c.descs[name]; ok {
+		return desc
+	}
+	if c.fixed {
+		return nil
+	}
+	desc := c.d.newDesc(CollectorGroupStandard, "stats", name, help, "node_name")
+	c.descs[name] = desc
+	return desc
+}
+
+func statisticHelp(path []string, desc string) string {
+	if desc == "" {
+		return "CouchDB statistic " + strings.Join(path, ".")
+	}
+	return desc
+}
+
+// statisticName derives a metric name from the path of a statistic, replacing characters invalid in metric names
+func statisticName(path []string, suffix string) string {
+	if suffix != "" {
+		path = append(path[:len(path):len(path)], suffix)
+	}
+	name := strings.ToLower(strings.Join(path, "_"))
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,130 @@
+package lib
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestStatsCollector(t *testing.T) {
+	nodeStats, err := os.ReadFile("../testdata/couchdb-stats-response-v2.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newCouchdbServer(map[string]string{
+		"/":                     `{"couchdb":"Welcome","version":"3.3.2"}`,
+		"/_membership":          `{"all_nodes":["node1@a"],"cluster_nodes":["node1@a"]}`,
+		"/_node/node1@a/_stats": string(nodeStats),
+	})
+	defer server.Close()
+
+	e, err := New(WithURI(server.URL), WithCollectorConfig(CollectorConfig{
+		Collectors: onlyCollectors("node_stats", "stats"),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+
+	tests := []struct {
+		name       string
+		metricType dto.MetricType
+	}{
+		{"couchdb_stats_couchdb_httpd_requests_total", dto.MetricType_COUNTER},
+		{"couchdb_stats_couch_replicator_checkpoints_success_total", dto.MetricType_COUNTER},
+		{"couchdb_stats_global_changes_server_pending_updates", dto.MetricType_GAUGE},
+		{"couchdb_stats_couchdb_request_time", dto.MetricType_SUMMARY},
+		{"couchdb_stats_couchdb_request_time_min", dto.MetricType_GAUGE},
+		// the curated metric is kept
+		{"couchdb_httpd_requests", dto.MetricType_GAUGE},
+	}
+	for _, test := range tests {
+		family, ok := byName[test.name]
+		if !ok {
+			t.Errorf("expected metric %s", test.name)
+			continue
+		}
+		if family.GetType() != test.metricType {
+			t.Errorf("expected %s to be a %s, got %s", test.name, test.metricType, family.GetType())
+		}
+	}
+	if requests := byName["couchdb_stats_couchdb_httpd_requests_total"]; requests != nil {
+		if value := requests.GetMetric()[0].GetCounter().GetValue(); value != 620 {
+			t.Errorf("expected 620 requests, got %v", value)
+		}
+	}
+	if requestTime := byName["couchdb_stats_couchdb_request_time"]; requestTime != nil {
+		if quantiles := requestTime.GetMetric()[0].GetSummary().GetQuantile(); len(quantiles) != 6 || quantiles[5].GetQuantile() != 0.999 {
+			t.Errorf("expected the quantiles of the percentiles up to 0.999, got %v", quantiles)
+		}
+	}
+}
+
+func TestStatisticName(t *testing.T) {
+	tests := []struct {
+		path     []string
+		suffix   string
+		expected string
+	}{
+		{[]string{"couchdb", "httpd", "requests"}, "total", "couchdb_httpd_requests_total"},
+		{[]string{"couchdb", "httpd_request_methods", "GET"}, "", "couchdb_httpd_request_methods_get"},
+		{[]string{"dreyfus", "index", "search-time"}, "", "dreyfus_index_search_time"},
+	}
+	for _, test := range tests {
+		if actual := statisticName(test.path, test.suffix); actual != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, actual)
+		}
+	}
+}
+
+func TestStatsCollectorPedanticRegistry(t *testing.T) {
+	nodeStats, err := os.ReadFile("../testdata/couchdb-stats-response-v2.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := map[string]string{
+		"/":                     `{"couchdb":"Welcome","version":"3.3.2"}`,
+		"/_membership":          `{"all_nodes":["node1@a"],"cluster_nodes":["node1@a"]}`,
+		"/_node/node1@a/_stats": string(nodeStats),
+	}
+	server := newCouchdbServer(responses)
+	defer server.Close()
+
+	e, err := New(WithURI(server.URL), WithCollectorConfig(CollectorConfig{
+		Collectors: onlyCollectors("node_stats", "stats"),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(e)
+
+	// statistics appearing after the registration are skipped
+	responses["/_node/node1@a/_stats"] = strings.Replace(string(nodeStats), `"couchdb": {`, `"couchdb": {"new_statistic": {"value": 1, "type": "counter", "desc": "new"},`, 1)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	if !names["couchdb_stats_couchdb_httpd_requests_total"] {
+		t.Errorf("expected the statistics described when registering")
+	}
+	if names["couchdb_stats_couchdb_new_statistic_total"] {
+		t.Errorf("expected the statistic unknown when registering to be skipped")
+	}
+}
@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("system", defaultEnabled, newSystemCollector)
+}
+
+// systemCollector exports the Erlang VM stats of each node from _system (CouchDB 2.x+)
+type systemCollector struct {
+	nodeMemoryOther         *prometheus.Desc
+	nodeMemoryAtom          *prometheus.Desc
+	nodeMemoryAtomUsed      *prometheus.Desc
+	nodeMemoryProcesses     *prometheus.Desc
+	nodeMemoryProcessesUsed *prometheus.Desc
+	nodeMemoryBinary        *prometheus.Desc
+	nodeMemoryCode          *prometheus.Desc
+	nodeMemoryEts           *prometheus.Desc
+	nodeMemoryTotal         *prometheus.Desc
+
+	uptime                  *prometheus.Desc
+	runQueue                *prometheus.Desc
+	runQueueDirtyCpu        *prometheus.Desc
+	etsTableCount           *prometheus.Desc
+	osProcCount             *prometheus.Desc
+	staleProcCount          *prometheus.Desc
+	processCount            *prometheus.Desc
+	processLimit            *prometheus.Desc
+	internalReplicationJobs *prometheus.Desc
+
+	contextSwitches        *prometheus.Desc
+	reductions             *prometheus.Desc
+	garbageCollectionCount *prometheus.Desc
+	wordsReclaimed         *prometheus.Desc
+	ioInput                *prometheus.Desc
+	ioOutput               *prometheus.Desc
+
+	messageQueueLength    *prometheus.Desc
+	messageQueueProcesses *prometheus.Desc
+
+	distributionRecvBytes     *prometheus.Desc
+	distributionRecvPackets   *prometheus.Desc
+	distributionRecvMax       *prometheus.Desc
+	distributionRecvAvg       *prometheus.Desc
+	distributionRecvDeviation *prometheus.Desc
+	distributionSendBytes     *prometheus.Desc
+	distributionSendPackets   *prometheus.Desc
+	distributionSendMax       *prometheus.Desc
+	distributionSendAvg       *prometheus.Desc
+	distributionSendPending   *prometheus.Desc
+}
+
+func newSystemCollector(d *metricDescs, logger *slog.Logger) Collector {
+	return &systemCollector{
+		nodeMemoryOther:         d.newDesc(CollectorGroupStandard, "erlang", "memory_other", "erlang memory counters - other", "node_name"),
+		nodeMemoryAtom:          d.newDesc(CollectorGroupStandard, "erlang", "memory_atom", "erlang memory counters - atom", "node_name"),
+		nodeMemoryAtomUsed:      d.newDesc(CollectorGroupStandard, "erlang", "memory_atom_used", "erlang memory counters - atom_used", "node_name"),
+		nodeMemoryProcesses:     d.newDesc(CollectorGroupStandard, "erlang", "memory_processes", "erlang memory counters - processes", "node_name"),
+		nodeMemoryProcessesUsed: d.newDesc(CollectorGroupStandard, "erlang", "memory_processes_used", "erlang memory counters - processes_used", "node_name"),
+		nodeMemoryBinary:        d.newDesc(CollectorGroupStandard, "erlang", "memory_binary", "erlang memory counters - binary", "node_name"),
+		nodeMemoryCode:          d.newDesc(CollectorGroupStandard, "erlang", "memory_code", "erlang memory counters - code", "node_name"),
+		nodeMemoryEts:           d.newDesc(CollectorGroupStandard, "erlang", "memory_ets", "erlang memory counters - ets", "node_name"),
+		nodeMemoryTotal:         d.newDesc(CollectorGroupStandard, "erlang", "memory_total", "erlang memory counters - total", "node_name"),
+
+		uptime:                  d.newDesc(CollectorGroupStandard, "erlang", "uptime_seconds", "uptime of the Erlang VM", "node_name"),
+		runQueue:                d.newDesc(CollectorGroupStandard, "erlang", "run_queue", "number of processes ready to run on the normal schedulers", "node_name"),
+		runQueueDirtyCpu:        d.newDesc(CollectorGroupStandard, "erlang", "run_queue_dirty_cpu", "number of processes ready to run on the dirty CPU schedulers (CouchDB 3.x)", "node_name"),
+		etsTableCount:           d.newDesc(CollectorGroupStandard, "erlang", "ets_table_count", "number of ETS tables", "node_name"),
+		osProcCount:             d.newDesc(CollectorGroupStandard, "erlang", "os_proc_count", "number of OS processes, like the JavaScript query servers", "node_name"),
+		staleProcCount:          d.newDesc(CollectorGroupStandard, "erlang", "stale_proc_count", "number of stale OS processes", "node_name"),
+		processCount:            d.newDesc(CollectorGroupStandard, "erlang", "process_count", "number of Erlang processes", "node_name"),
+		processLimit:            d.newDesc(CollectorGroupStandard, "erlang", "process_limit", "maximum number of Erlang processes", "node_name"),
+		internalReplicationJobs: d.newDesc(CollectorGroupStandard, "erlang", "internal_replication_jobs", "number of pending internal replication jobs between the shard copies", "node_name"),
+
+		contextSwitches:        d.newDesc(CollectorGroupStandard, "erlang", "context_switches_total", "number of context switches since the start of the Erlang VM", "node_name"),
+		reductions:             d.newDesc(CollectorGroupStandard, "erlang", "reductions_total", "number of reductions since the start of the Erlang VM", "node_name"),
+		garbageCollectionCount: d.newDesc(CollectorGroupStandard, "erlang", "garbage_collections_total", "number of garbage collections since the start of the Erlang VM", "node_name"),
+		wordsReclaimed:         d.newDesc(CollectorGroupStandard, "erlang", "words_reclaimed_total", "number of words reclaimed by garbage collections since the start of the Erlang VM", "node_name"),
+		ioInput:                d.newDesc(CollectorGroupStandard, "erlang", "io_input_bytes_total", "number of bytes received through ports since the start of the Erlang VM", "node_name"),
+		ioOutput:               d.newDesc(CollectorGroupStandard, "erlang", "io_output_bytes_total", "number of bytes sent through ports since the start of the Erlang VM", "node_name"),
+
+		messageQueueLength:    d.newDesc(CollectorGroupStandard, "erlang", "message_queue_length", "message queue length of a named process, or the maximum of a process group", "node_name", "process"),
+		messageQueueProcesses: d.newDesc(CollectorGroupStandard, "erlang", "message_queue_processes", "number of processes of a process group like couch_file", "node_name", "process"),
+
+		distributionRecvBytes:     d.newDesc(CollectorGroupStandard, "erlang", "distribution_recv_bytes_total", "number of bytes received from the peer node", "node_name", "peer"),
+		distributionRecvPackets:   d.newDesc(CollectorGroupStandard, "erlang", "distribution_recv_packets_total", "number of packets received from the peer node", "node_name", "peer"),
+		distributionRecvMax:       d.newDesc(CollectorGroupStandard, "erlang", "distribution_recv_max_packet_bytes", "size of the largest packet received from the peer node", "node_name", "peer"),
+		distributionRecvAvg:       d.newDesc(CollectorGroupStandard, "erlang", "distribution_recv_avg_packet_bytes", "average size of the packets received from the peer node", "node_name", "peer"),
+		distributionRecvDeviation: d.newDesc(CollectorGroupStandard, "erlang", "distribution_recv_packet_deviation_bytes", "average deviation of the size of the packets received from the peer node", "node_name", "peer"),
+		distributionSendBytes:     d.newDesc(CollectorGroupStandard, "erlang", "distribution_send_bytes_total", "number of bytes sent to the peer node", "node_name", "peer"),
+		distributionSendPackets:   d.newDesc(CollectorGroupStandard, "erlang", "distribution_send_packets_total", "number of packets sent to the peer node", "node_name", "peer"),
+		distributionSendMax:       d.newDesc(CollectorGroupStandard, "erlang", "distribution_send_max_packet_bytes", "size of the largest packet sent to the peer node", "node_name", "peer"),
+		distributionSendAvg:       d.newDesc(CollectorGroupStandard, "erlang", "distribution_send_avg_packet_bytes", "average size of the packets sent to the peer node", "node_name", "peer"),
+		distributionSendPending:   d.newDesc(CollectorGroupStandard, "erlang", "distribution_send_pending_bytes", "number of bytes waiting to be sent to the peer node", "node_name", "peer"),
+	}
+}
+
+func (c *systemCollector) Update(b *snapshotBuilder, stats Stats, config CollectorConfig) error {
+	allowedMessageQueues := allowlist(config.MessageQueues)
+	for nodeName, metric := range stats.SystemByNodeName {
+		b.set(c.nodeMemoryOther, metric.MemoryStatsResponse.Other, nodeName)
+		b.set(c.nodeMemoryAtom, metric.MemoryStatsResponse.Atom, nodeName)
+		b.set(c.nodeMemoryAtomUsed, metric.MemoryStatsResponse.AtomUsed, nodeName)
+		b.set(c.nodeMemoryProcesses, metric.MemoryStatsResponse.Processes, nodeName)
+		b.set(c.nodeMemoryProcessesUsed, metric.MemoryStatsResponse.ProcessesUsed, nodeName)
+		b.set(c.nodeMemoryBinary, metric.MemoryStatsResponse.Binary, nodeName)
+		b.set(c.nodeMemoryCode, metric.MemoryStatsResponse.Code, nodeName)
+		b.set(c.nodeMemoryEts, metric.MemoryStatsResponse.Ets, nodeName)
+		b.set(c.nodeMemoryTotal, metric.MemoryStatsResponse.Total, nodeName)
+
+		b.set(c.uptime, metric.Uptime, nodeName)
+		b.set(c.runQueue, metric.RunQueue, nodeName)
+		if metric.RunQueueDirtyCpu != nil {
+			b.set(c.runQueueDirtyCpu, *metric.RunQueueDirtyCpu, nodeName)
+		}
+		b.set(c.etsTableCount, metric.EtsTableCount, nodeName)
+		b.set(c.osProcCount, metric.OsProcCount, nodeName)
+		b.set(c.staleProcCount, metric.StaleProcCount, nodeName)
+		b.set(c.processCount, metric.ProcessCount, nodeName)
+		b.set(c.processLimit, metric.ProcessLimit, nodeName)
+		b.set(c.internalReplicationJobs, metric.InternalReplicationJobs, nodeName)
+
+		b.setCounter(c.contextSwitches, metric.ContextSwitches, nodeName)
+		b.setCounter(c.reductions, metric.Reductions, nodeName)
+		b.setCounter(c.garbageCollectionCount, metric.GarbageCollectionCount, nodeName)
+		b.setCounter(c.wordsReclaimed, metric.WordsReclaimed, nodeName)
+		b.setCounter(c.ioInput, metric.IoInput, nodeName)
+		b.setCounter(c.ioOutput, metric.IoOutput, nodeName)
+
+		for process, queue := range metric.MessageQueues {
+			if allowedMessageQueues != nil && !allowedMessageQueues[process] {
+				continue
+			}
+			b.set(c.messageQueueLength, queue.Length, nodeName, process)
+			if queue.Summary != nil {
+				b.set(c.messageQueueProcesses, queue.Summary.Count, nodeName, process)
+			}
+		}
+
+		for peer, distribution := range metric.Distribution {
+			b.setCounter(c.distributionRecvBytes, distribution.RecvOct, nodeName, peer)
+			b.setCounter(c.distributionRecvPackets, distribution.RecvCnt, nodeName, peer)
+			b.set(c.distributionRecvMax, distribution.RecvMax, nodeName, peer)
+			b.set(c.distributionRecvAvg, distribution.RecvAvg, nodeName, peer)
+			b.set(c.distributionRecvDeviation, distribution.RecvDvi, nodeName, peer)
+			b.setCounter(c.distributionSendBytes, distribution.SendOct, nodeName, peer)
+			b.setCounter(c.distributionSendPackets, distribution.SendCnt, nodeName, peer)
+			b.set(c.distributionSendMax, distribution.SendMax, nodeName, peer)
+			b.set(c.distributionSendAvg, distribution.SendAvg, nodeName, peer)
+			b.set(c.distributionSendPending, distribution.SendPend, nodeName, peer)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// scrapeSystem scrapes the system collector with the _system response of a CouchDB 3.x node
+func scrapeSystem(t *testing.T, config CollectorConfig) (*metricsSnapshot, *systemCollector) {
+	return scrapeSystemResponse(t, config, "v3")
+}
+
+// scrapeSystemResponse scrapes the system collector with the _system response of the testdata by its version suffix
+func scrapeSystemResponse(t *testing.T, config CollectorConfig, versionSuffix string) (*metricsSnapshot, *systemCollector) {
+	system, err := os.ReadFile("../testdata/couchdb-system-response-" + versionSuffix + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Collectors = onlyCollectors("system")
+	snapshot, e := scrapeWith(t, map[string]string{
+		"/":                      `{"couchdb":"Welcome","version":"3.3.2"}`,
+		"/_membership":           `{"all_nodes":["node1@a"],"cluster_nodes":["node1@a"]}`,
+		"/_node/node1@a/_system": string(system),
+	}, config)
+	return snapshot, e.collectors["system"].(*systemCollector)
+}
+
+func TestSystemCollector(t *testing.T) {
+	snapshot, c := scrapeSystem(t, CollectorConfig{})
+
+	tests := []struct {
+		desc     *prometheus.Desc
+		expected float64
+		counter  bool
+	}{
+		{c.uptime, 259, false},
+		{c.nodeMemoryTotal, 10545009 + 512625 + 12386272 + 417968 + 10659329 + 1620440, false},
+		{c.etsTableCount, 157, false},
+		{c.processCount, 1096, false},
+		{c.processLimit, 262144, false},
+		{c.osProcCount, 1, false},
+		{c.reductions, 99581958, true},
+		{c.ioOutput, 7044215, true},
+	}
+	for _, test := range tests {
+		for _, metric := range snapshot.metrics {
+			if metric.Desc() != test.desc {
+				continue
+			}
+			var m dto.Metric
+			if err := metric.Write(&m); err != nil {
+				t.Fatal(err)
+			}
+			if (m.GetCounter() != nil) != test.counter {
+				t.Errorf("expected %s to be a counter: %v", test.desc, test.counter)
+			}
+		}
+		actual := snapshotValues(t, snapshot, test.desc)["node_name=node1@a"]
+		if actual != test.expected {
+			t.Errorf("expected %v for %s, got %v", test.expected, test.desc, actual)
+		}
+	}
+}
+
+func TestSystemCollectorMessageQueueAllowlist(t *testing.T) {
+	snapshot, c := scrapeSystem(t, CollectorConfig{MessageQueues: []string{"couch_file", "mem3_shards"}})
+
+	actual := snapshotValues(t, snapshot, c.messageQueueLength)
+	expected := map[string]float64{
+		"node_name=node1@a,process=couch_file":  0,
+		"node_name=node1@a,process=mem3_shards": 3,
+	}
+	if len(actual) != len(expected) {
+		t.Errorf("expected only the allowed processes %v, got %v", expected, actual)
+	}
+	for labels, value := range expected {
+		if v, ok := actual[labels]; !ok || v != value {
+			t.Errorf("expected %v for %s, got %v", value, labels, actual)
+		}
+	}
+
+	processes := snapshotValues(t, snapshot, c.messageQueueProcesses)
+	if len(processes) != 1 || processes["node_name=node1@a,process=couch_file"] != 2 {
+		t.Errorf("expected the number of processes of the allowed process group only, got %v", processes)
+	}
+}
+
+func TestSystemCollectorDistribution(t *testing.T) {
+	snapshot, c := scrapeSystem(t, CollectorConfig{})
+
+	tests := []struct {
+		desc     *prometheus.Desc
+		expected float64
+	}{
+		{c.distributionRecvBytes, 30158},
+		{c.distributionRecvPackets, 412},
+		{c.distributionRecvDeviation, 38},
+		{c.distributionSendBytes, 32012},
+		{c.distributionSendMax, 1307},
+		{c.distributionSendPending, 0},
+	}
+	for _, test := range tests {
+		actual, ok := snapshotValues(t, snapshot, test.desc)["node_name=node1@a,peer=couchdb@node2"]
+		if !ok || actual != test.expected {
+			t.Errorf("expected %v for %s, got %v", test.expected, test.desc, actual)
+		}
+	}
+}
+
+func TestSystemCollectorRunQueueDirtyCpu(t *testing.T) {
+	snapshot, c := scrapeSystemResponse(t, CollectorConfig{}, "v3")
+	if _, ok := snapshotValues(t, snapshot, c.runQueueDirtyCpu)["node_name=node1@a"]; !ok {
+		t.Errorf("expected the dirty CPU run queue reported by CouchDB 3.x")
+	}
+
+	snapshot, c = scrapeSystemResponse(t, CollectorConfig{}, "v2")
+	if values := snapshotValues(t, snapshot, c.runQueueDirtyCpu); len(values) != 0 {
+		t.Errorf("expected no dirty CPU run queue without CouchDB reporting it, got %v", values)
+	}
+	if _, ok := snapshotValues(t, snapshot, c.runQueue)["node_name=node1@a"]; !ok {
+		t.Errorf("expected the run queue reported by CouchDB 2.x")
+	}
+}
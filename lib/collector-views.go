@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("views", defaultEnabled, newViewsCollector)
+}
+
+// viewsCollector exports the staleness of the views of each observed database
+type viewsCollector struct {
+	logger *slog.Logger
+
+	viewStaleness *prometheus.Desc
+}
+
+func newViewsCollector(d *metricDescs, logger *slog.Logger) Collector {
+	return &viewsCollector{
+		logger: logger,
+
+		viewStaleness: d.newDesc(CollectorGroupViews, "view", "staleness", "the view's staleness (the view's update_seq compared to the database's update_seq)", "db_name", "design_doc_name", "view_name", "shard_begin", "shard_end"),
+	}
+}
+
+func (c *viewsCollector) Update(b *snapshotBuilder, stats Stats, config CollectorConfig) error {
+	for _, dbName := range config.ObservedDatabases {
+		dbStats := stats.DatabaseStatsByDbName[dbName]
+		for designDoc, view := range dbStats.Views {
+			for viewName, updateSeq := range view {
+				var err error
+				if stats.ApiVersion == "2" {
+					err = c.updateV2(b, dbName, dbStats.UpdateSeq, designDoc, viewName, updateSeq)
+				} else {
+					err = c.updateV1(b, dbName, dbStats.UpdateSeq, designDoc, viewName, updateSeq)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *viewsCollector) updateV1(b *snapshotBuilder, dbName string, dbUpdateSeq json.RawMessage, designDoc string, viewName string, updateSeq string) error {
+	var intSeq int64
+	err := json.Unmarshal(dbUpdateSeq, &intSeq)
+	if err != nil {
+		c.logger.Warn(fmt.Sprintf("%v", err))
+		return nil
+	}
+	viewUpdateSeq, _ := strconv.ParseInt(updateSeq, 10, 64)
+	age := intSeq - viewUpdateSeq
+	b.set(c.viewStaleness, float64(age), dbName, designDoc, viewName, "0", "1")
+	return nil
+}
+
+func (c *viewsCollector) updateV2(b *snapshotBuilder, dbName string, dbUpdateSeq json.RawMessage, designDoc string, viewName string, updateSeq string) error {
+	var stringSeq string
+	err := json.Unmarshal(dbUpdateSeq, &stringSeq)
+	if err != nil {
+		c.logger.Warn(fmt.Sprintf("%v", err))
+		return nil
+	}
+	dbRangeSeqs, err := DecodeUpdateSeq(stringSeq)
+	if err != nil {
+		return err
+	}
+
+	viewRangeSeqs, err := DecodeUpdateSeq(updateSeq)
+	if err != nil {
+		return err
+	}
+
+	for _, viewRangeSeq := range viewRangeSeqs {
+		for _, dbRangeSeq := range dbRangeSeqs {
+			if viewRangeSeq.Range[0].Cmp(dbRangeSeq.Range[0]) == 0 {
+				age := dbRangeSeq.Seq - viewRangeSeq.Seq
+				b.set(c.viewStaleness, float64(age),
+					dbName,
+					designDoc,
+					viewName,
+					viewRangeSeq.Range[0].String(),
+					viewRangeSeq.Range[1].String())
+			}
+		}
+	}
+	return nil
+}
@@ -1,8 +1,8 @@
 package lib
 
 import (
+	"context"
 	"fmt"
-	"log/slog"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -11,12 +11,6 @@ import (
 const AllDbs = "_all_dbs"
 
 var (
-	exposedHttpStatusCodes = []string{
-		"200", "201", "202",
-		"301", "304",
-		"400", "401", "403", "404", "405", "409", "412",
-		"500"}
-
 	exposedLogLevels = []string{
 		"alert",
 		"critical",
@@ -78,6 +72,51 @@ type CollectorConfig struct {
 	CollectViews         bool
 	CollectSchedulerJobs bool
 	ConcurrentRequests   uint
+	// FilteredCacheAge is the minimum age of cached results per collector group
+	// before the filtered handler scrapes CouchDB again. 0 disables caching.
+	FilteredCacheAge time.Duration
+	// DatabaseShard restricts the observed databases to the ones hashing into this exporter's shard.
+	DatabaseShard DatabaseShard
+	// MaxRequests limits the number of per-database and view requests per scrape.
+	// Databases exceeding the budget are scraped in rotation. 0 means unlimited.
+	MaxRequests uint
+	// MaxSnapshotAge drops the metrics of the last successful asynchronous scrape once they exceed this age.
+	// 0 serves them until the next successful scrape.
+	MaxSnapshotAge time.Duration
+	// AdaptiveConcurrency shrinks the concurrent requests when CouchDB responds slowly or with 5xx errors,
+	// and grows them again up to ConcurrentRequests while CouchDB is healthy.
+	AdaptiveConcurrency      bool
+	AdaptiveLatencyThreshold time.Duration
+	// CircuitBreakerFailures pauses the databases and views collectors after this many
+	// consecutive failures, for CircuitBreakerCooldown. 0 disables the circuit breakers.
+	CircuitBreakerFailures uint
+	CircuitBreakerCooldown time.Duration
+	// NodeUris map the nodes to be scraped directly instead of through the coordinator behind the URI.
+	// Statically mapped nodes are still scraped while the coordinator is down.
+	NodeUris NodeUris
+	// MessageQueues limits the processes whose message queue length is exported, empty exports all processes.
+	MessageQueues []string
+	// HttpStatusCodes limits the exported HTTP status codes, empty exports all status codes reported by CouchDB.
+	HttpStatusCodes []string
+	// HttpRequestMethods limits the exported HTTP request methods, empty exports all methods reported by CouchDB.
+	HttpRequestMethods []string
+	// MetricNaming selects whether CouchDB counters are exported as legacy gauges, as counters with a _total suffix, or both.
+	MetricNaming MetricNaming
+	// Collectors enables or disables collectors by name, overriding their defaults.
+	// See CollectorNames for the available collectors.
+	Collectors map[string]bool
+}
+
+// allowlist returns the values as a set, or nil for an empty list, which allows all values
+func allowlist(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(values))
+	for _, value := range values {
+		allowed[value] = true
+	}
+	return allowed
 }
 
 type ActiveTaskTypes struct {
@@ -106,344 +145,151 @@ type MemoryTypesByNodeName map[string]MemoryMetrics
 // Describe describes all the metrics ever exported by the couchdb exporter. It
 // implements prometheus.Collector.
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- e.up.Desc()
-	e.databasesTotal.Describe(ch)
-	e.nodeUp.Describe(ch)
-	e.nodeInfo.Describe(ch)
-
-	e.authCacheHits.Describe(ch)
-	e.authCacheMisses.Describe(ch)
-	e.databaseReads.Describe(ch)
-	e.databaseWrites.Describe(ch)
-	e.openDatabases.Describe(ch)
-	e.openOsFiles.Describe(ch)
-	e.requestTime.Describe(ch)
-
-	e.httpdStatusCodes.Describe(ch)
-	e.httpdRequestMethods.Describe(ch)
-
-	e.bulkRequests.Describe(ch)
-	e.clientsRequestingChanges.Describe(ch)
-	e.requests.Describe(ch)
-	e.temporaryViewReads.Describe(ch)
-	e.viewReads.Describe(ch)
-
-	e.dbInfo.Describe(ch)
-	e.diskSize.Describe(ch)
-	e.dataSize.Describe(ch)
-	e.docCount.Describe(ch)
-	e.docDelCount.Describe(ch)
-	e.compactRunning.Describe(ch)
-	e.diskSizeOverhead.Describe(ch)
-
-	e.activeTasks.Describe(ch)
-	e.activeTasksDatabaseCompaction.Describe(ch)
-	e.activeTasksViewCompaction.Describe(ch)
-	e.activeTasksIndexer.Describe(ch)
-	e.activeTasksReplication.Describe(ch)
-	e.activeTasksReplicationLastUpdate.Describe(ch)
-	e.activeTasksReplicationChangesPending.Describe(ch)
-
-	e.couchLog.Describe(ch)
-
-	e.fabricWorker.Describe(ch)
-	e.fabricOpenShard.Describe(ch)
-	e.fabricReadRepairs.Describe(ch)
-	e.fabricDocUpdate.Describe(ch)
-
-	e.couchReplicatorChangesReadFailures.Describe(ch)
-	e.couchReplicatorChangesReaderDeaths.Describe(ch)
-	e.couchReplicatorChangesManagerDeaths.Describe(ch)
-	e.couchReplicatorChangesQueueDeaths.Describe(ch)
-	e.couchReplicatorCheckpoints.Describe(ch)
-	e.couchReplicatorFailedStarts.Describe(ch)
-	e.couchReplicatorRequests.Describe(ch)
-	e.couchReplicatorResponses.Describe(ch)
-	e.couchReplicatorStreamResponses.Describe(ch)
-	e.couchReplicatorWorkerDeaths.Describe(ch)
-	e.couchReplicatorWorkersStarted.Describe(ch)
-	e.couchReplicatorClusterIsStable.Describe(ch)
-	e.couchReplicatorDbScans.Describe(ch)
-	e.couchReplicatorDocs.Describe(ch)
-	e.couchReplicatorJobs.Describe(ch)
-	e.couchReplicatorConnection.Describe(ch)
-
-	e.nodeMemoryOther.Describe(ch)
-	e.nodeMemoryAtom.Describe(ch)
-	e.nodeMemoryAtomUsed.Describe(ch)
-	e.nodeMemoryProcesses.Describe(ch)
-	e.nodeMemoryProcessesUsed.Describe(ch)
-	e.nodeMemoryBinary.Describe(ch)
-	e.nodeMemoryCode.Describe(ch)
-	e.nodeMemoryEts.Describe(ch)
-
-	e.viewStaleness.Describe(ch)
-
-	e.schedulerJobs.Describe(ch)
-
-	e.requestCount.Describe(ch)
-
-	e.mangoUnindexedQueries.Describe(ch)
-	e.mangoInvalidIndexes.Describe(ch)
-	e.mangoTooManyDocs.Describe(ch)
-	e.mangoDocsExamined.Describe(ch)
-	e.mangoQuorumDocsExamined.Describe(ch)
-	e.mangoResultsReturned.Describe(ch)
-	e.mangoQueryTime.Describe(ch)
-	e.mangoEvaluateSelectors.Describe(ch)
+	e.describeStatistics()
+	e.groupCollector(nil, allCollectorGroups...).Describe(ch)
 }
 
-func (e *Exporter) resetAllMetrics() {
-	metrics := []*prometheus.GaugeVec{
-		e.nodeUp,
-		e.nodeInfo,
-
-		e.authCacheHits,
-		e.authCacheMisses,
-		e.databaseReads,
-		e.databaseWrites,
-		e.openDatabases,
-		e.openOsFiles,
-		e.requestTime,
-
-		e.httpdStatusCodes,
-		e.httpdRequestMethods,
-
-		e.clientsRequestingChanges,
-		e.temporaryViewReads,
-		e.requests,
-		e.bulkRequests,
-		e.viewReads,
-
-		e.dbInfo,
-		e.diskSize,
-		e.dataSize,
-		e.docCount,
-		e.docDelCount,
-		e.compactRunning,
-		e.diskSizeOverhead,
-
-		e.activeTasks,
-		e.activeTasksDatabaseCompaction,
-		e.activeTasksViewCompaction,
-		e.activeTasksIndexer,
-		e.activeTasksReplication,
-		e.activeTasksReplicationLastUpdate,
-		e.activeTasksReplicationChangesPending,
-
-		e.couchLog,
-
-		e.fabricWorker,
-		e.fabricOpenShard,
-		e.fabricReadRepairs,
-		e.fabricDocUpdate,
-
-		e.couchReplicatorChangesReadFailures,
-		e.couchReplicatorChangesReaderDeaths,
-		e.couchReplicatorChangesManagerDeaths,
-		e.couchReplicatorChangesQueueDeaths,
-		e.couchReplicatorCheckpoints,
-		e.couchReplicatorFailedStarts,
-		e.couchReplicatorRequests,
-		e.couchReplicatorResponses,
-		e.couchReplicatorStreamResponses,
-		e.couchReplicatorWorkerDeaths,
-		e.couchReplicatorWorkersStarted,
-		e.couchReplicatorClusterIsStable,
-		e.couchReplicatorDbScans,
-		e.couchReplicatorDocs,
-		e.couchReplicatorJobs,
-		e.couchReplicatorConnection,
-
-		e.nodeMemoryOther,
-		e.nodeMemoryAtom,
-		e.nodeMemoryAtomUsed,
-		e.nodeMemoryProcesses,
-		e.nodeMemoryProcessesUsed,
-		e.nodeMemoryBinary,
-		e.nodeMemoryCode,
-		e.nodeMemoryEts,
-
-		e.viewStaleness,
-
-		e.schedulerJobs,
-
-		e.mangoUnindexedQueries,
-		e.mangoInvalidIndexes,
-		e.mangoTooManyDocs,
-		e.mangoDocsExamined,
-		e.mangoQuorumDocsExamined,
-		e.mangoResultsReturned,
-		e.mangoQueryTime,
-		e.mangoEvaluateSelectors,
+// describeStatistics derives the metrics of the stats collector from the _stats of the nodes once,
+// since a registry only accepts the metrics described when registering the exporter
+func (e *Exporter) describeStatistics() {
+	c, ok := e.collectors["stats"].(*statsCollector)
+	if !ok {
+		return
 	}
-	e.resetMetrics(metrics)
+	c.describeOnce.Do(func() {
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+
+		config := e.collectorConfig
+		config.Collectors = make(map[string]bool)
+		for _, name := range CollectorNames() {
+			config.Collectors[name] = name == "stats"
+		}
+		stats, err := e.client.getStats(e.ctx, config, nil)
+		if err != nil {
+			e.logger.Warn(fmt.Sprintf("error reading the stats to describe their metrics, describing them on first use: %v", err))
+			return
+		}
+		c.describe(newSnapshotBuilder(e.metricDescs), stats, config)
+	})
 }
 
-func (e *Exporter) resetMetrics(metrics []*prometheus.GaugeVec) {
-	for _, metricVec := range metrics {
-		metricVec.Reset()
+// liveCollectors are the exporter's own metrics, which are updated continuously instead of per scrape
+func (e *Exporter) liveCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		e.lastSuccess,
+		e.scrapeFailures,
+		e.semaphoreWaitSeconds,
+		e.requestsInFlight,
+		e.httpRequestDuration,
+		e.httpResponseSize,
+		e.httpRequestErrors,
 	}
 }
 
-func (e *Exporter) getObservedDatabaseNames(candidates []string) ([]string, error) {
+func (e *Exporter) getObservedDatabaseNames(ctx context.Context, candidates []string) ([]string, error) {
 	if len(candidates) == 1 && candidates[0] == AllDbs {
-		return e.client.getDatabaseList()
+		databases, err := e.client.getDatabaseList(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return e.collectorConfig.DatabaseShard.Filter(databases), nil
 	}
-	return candidates, nil
+	return e.collectorConfig.DatabaseShard.Filter(candidates), nil
 }
 
-func (e *Exporter) scrape() error {
-	if e.collectorConfig.ScrapeInterval != 0 {
-		// we have to protect collects during scrapes when scraping asynchronously
-		// otherwise the Collect() might get only partial stats
-		e.mutex.Lock()
-		defer e.mutex.Unlock()
-	}
-
-	e.resetAllMetrics()
+func (e *Exporter) scrape() (*metricsSnapshot, error) {
+	return e.scrapeDatabases(e.collectorConfig, DatabaseSelection{})
+}
 
-	e.up.Set(0)
+// scrapeDatabases scrapes CouchDB into a new snapshot with the collectors enabled by the config,
+// observing only the configured databases which match the selection.
+// Scrapes are serialized, since they share the request count and the database sampler.
+func (e *Exporter) scrapeDatabases(config CollectorConfig, selection DatabaseSelection) (*metricsSnapshot, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	start := time.Now()
+	b := newSnapshotBuilder(e.metricDescs)
+	err := e.scrapeInto(b, config, selection)
+	b.set(e.scrapeDuration, time.Since(start).Seconds())
+	return e.recordScrapeResult(b, err), err
+}
 
-	e.requestCount.Set(-1)
+func (e *Exporter) scrapeInto(b *snapshotBuilder, config CollectorConfig, selection DatabaseSelection) error {
 	e.client.ResetRequestCount()
 
-	var databases, err = e.getObservedDatabaseNames(e.collectorConfig.Databases)
-	if err != nil {
-		return err
-	}
-	e.collectorConfig.ObservedDatabases = databases
-
-	stats, err := e.client.getStats(e.collectorConfig)
-	if err != nil {
-		return fmt.Errorf("error collecting couchdb stats: %v", err)
-	}
-	e.up.Set(1)
-	e.requestCount.Set(float64(e.client.GetRequestCount()))
-
-	if stats.ApiVersion == "2" {
-		err = e.collectV2(stats, exposedHttpStatusCodes, e.collectorConfig)
+	var databases []string
+	if config.anyCollectorEnabled("databases", "views") {
+		var err error
+		databases, err = e.getObservedDatabaseNames(e.ctx, config.Databases)
 		if err != nil {
 			return err
 		}
-	} else {
-		err = e.collectV1(stats, exposedHttpStatusCodes, e.collectorConfig)
-		if err != nil {
-			return err
+	}
+	e.sampler.prune(databases)
+	observedDatabases := selection.Filter(databases)
+	config.ObservedDatabases = e.sampler.next(observedDatabases, config.collectorEnabled("views"))
+
+	timings := make(phaseTimings)
+	stats, err := e.client.getStats(e.ctx, config, timings)
+	for phase, duration := range timings {
+		b.set(e.scrapePhaseDuration, duration.Seconds(), phase)
+	}
+	for group, open := range e.client.CircuitOpenByCollector() {
+		circuitOpen := 0.0
+		if open {
+			circuitOpen = 1
 		}
+		b.set(e.circuitOpen, circuitOpen, string(group))
 	}
-	return nil
-}
-
-func (e *Exporter) collect(ch chan<- prometheus.Metric) error {
-	sendStatus := func() {
-		ch <- e.up
+	if e.client.limiter != nil {
+		b.set(e.concurrencyLimit, float64(e.client.limiter.Limit()))
+	}
+	if err != nil {
+		return fmt.Errorf("error collecting couchdb stats: %v", err)
+	}
+	b.set(e.requestCount, float64(e.client.GetRequestCount()))
+
+	if e.sampler.enabled() {
+		now := time.Now()
+		stats.DatabaseStatsByDbName = e.sampler.merge(observedDatabases, stats.DatabaseStatsByDbName, now)
+		ages := e.sampler.ages(now)
+		sampledDatabases := make([]string, 0, len(observedDatabases))
+		for _, dbName := range observedDatabases {
+			if _, ok := stats.DatabaseStatsByDbName[dbName]; ok {
+				sampledDatabases = append(sampledDatabases, dbName)
+				b.set(e.sampleAge, ages[dbName].Seconds(), dbName)
+			}
+		}
+		config.ObservedDatabases = sampledDatabases
 	}
-	defer sendStatus()
 
-	if e.collectorConfig.ScrapeInterval == 0 {
-		// scrape now, before collecting stats into metrics
-		err := e.scrape()
+	for name, collector := range e.collectors {
+		if !config.collectorEnabled(name) {
+			continue
+		}
+		err := collector.Update(b, stats, config)
 		if err != nil {
-			return err
+			return fmt.Errorf("error updating the %s collector: %v", name, err)
 		}
 	}
-
-	e.databasesTotal.Collect(ch)
-	e.nodeUp.Collect(ch)
-	e.nodeInfo.Collect(ch)
-
-	e.authCacheHits.Collect(ch)
-	e.authCacheMisses.Collect(ch)
-	e.databaseReads.Collect(ch)
-	e.databaseWrites.Collect(ch)
-	e.openDatabases.Collect(ch)
-	e.openOsFiles.Collect(ch)
-	e.requestTime.Collect(ch)
-
-	e.httpdStatusCodes.Collect(ch)
-	e.httpdRequestMethods.Collect(ch)
-
-	e.bulkRequests.Collect(ch)
-	e.clientsRequestingChanges.Collect(ch)
-	e.requests.Collect(ch)
-	e.temporaryViewReads.Collect(ch)
-	e.viewReads.Collect(ch)
-
-	e.dbInfo.Collect(ch)
-	e.diskSize.Collect(ch)
-	e.dataSize.Collect(ch)
-	e.docCount.Collect(ch)
-	e.docDelCount.Collect(ch)
-	e.compactRunning.Collect(ch)
-	e.diskSizeOverhead.Collect(ch)
-
-	e.activeTasks.Collect(ch)
-	e.activeTasksDatabaseCompaction.Collect(ch)
-	e.activeTasksViewCompaction.Collect(ch)
-	e.activeTasksIndexer.Collect(ch)
-	e.activeTasksReplication.Collect(ch)
-	e.activeTasksReplicationLastUpdate.Collect(ch)
-	e.activeTasksReplicationChangesPending.Collect(ch)
-
-	e.couchLog.Collect(ch)
-
-	e.fabricWorker.Collect(ch)
-	e.fabricOpenShard.Collect(ch)
-	e.fabricReadRepairs.Collect(ch)
-	e.fabricDocUpdate.Collect(ch)
-
-	e.couchReplicatorChangesReadFailures.Collect(ch)
-	e.couchReplicatorChangesReaderDeaths.Collect(ch)
-	e.couchReplicatorChangesManagerDeaths.Collect(ch)
-	e.couchReplicatorChangesQueueDeaths.Collect(ch)
-	e.couchReplicatorCheckpoints.Collect(ch)
-	e.couchReplicatorFailedStarts.Collect(ch)
-	e.couchReplicatorRequests.Collect(ch)
-	e.couchReplicatorResponses.Collect(ch)
-	e.couchReplicatorStreamResponses.Collect(ch)
-	e.couchReplicatorWorkerDeaths.Collect(ch)
-	e.couchReplicatorWorkersStarted.Collect(ch)
-	e.couchReplicatorClusterIsStable.Collect(ch)
-	e.couchReplicatorDbScans.Collect(ch)
-	e.couchReplicatorDocs.Collect(ch)
-	e.couchReplicatorJobs.Collect(ch)
-	e.couchReplicatorConnection.Collect(ch)
-
-	e.nodeMemoryOther.Collect(ch)
-	e.nodeMemoryAtom.Collect(ch)
-	e.nodeMemoryAtomUsed.Collect(ch)
-	e.nodeMemoryProcesses.Collect(ch)
-	e.nodeMemoryProcessesUsed.Collect(ch)
-	e.nodeMemoryBinary.Collect(ch)
-	e.nodeMemoryCode.Collect(ch)
-	e.nodeMemoryEts.Collect(ch)
-
-	e.viewStaleness.Collect(ch)
-
-	e.schedulerJobs.Collect(ch)
-
-	e.requestCount.Collect(ch)
-
-	e.mangoUnindexedQueries.Collect(ch)
-	e.mangoInvalidIndexes.Collect(ch)
-	e.mangoTooManyDocs.Collect(ch)
-	e.mangoDocsExamined.Collect(ch)
-	e.mangoQuorumDocsExamined.Collect(ch)
-	e.mangoResultsReturned.Collect(ch)
-	e.mangoQueryTime.Collect(ch)
-	e.mangoEvaluateSelectors.Collect(ch)
-
 	return nil
 }
 
 // Collect fetches the stats from configured couchdb location and delivers them
 // as Prometheus metrics. It implements prometheus.Collector.
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	e.mutex.RLock() // To protect metrics from concurrent collects.
-	defer e.mutex.RUnlock()
-	if err := e.collect(ch); err != nil {
-		slog.Error(fmt.Sprintf("Error collecting stats: %s", err))
+	var snapshot *metricsSnapshot
+	if e.collectorConfig.ScrapeInterval != 0 {
+		// serve the last snapshot, without waiting for a running scrape
+		snapshot = e.snapshot.Load()
+	} else {
+		var err error
+		snapshot, err = e.scrape()
+		if err != nil {
+			e.logger.Error(fmt.Sprintf("Error collecting stats: %s", err))
+		}
 	}
-	return
+	e.groupCollector(snapshot, allCollectorGroups...).Collect(ch)
 }
@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"log/slog"
+	"sort"
+)
+
+const (
+	defaultEnabled  = true
+	defaultDisabled = false
+)
+
+// Collector exports the metrics of a single CouchDB data source, e.g. the node stats or the scheduler jobs
+type Collector interface {
+	// Update adds the collector's metrics from the stats of a scrape to the snapshot
+	Update(b *snapshotBuilder, stats Stats, config CollectorConfig) error
+}
+
+// collectorFactory creates a collector, registering its metric descriptions with the exporter's descs
+type collectorFactory func(d *metricDescs, logger *slog.Logger) Collector
+
+var (
+	collectorFactories = make(map[string]collectorFactory)
+	collectorDefaults  = make(map[string]bool)
+)
+
+// registerCollector makes a collector available under its name, to be enabled or disabled with --[no-]collector.<name>
+func registerCollector(name string, isDefaultEnabled bool, factory collectorFactory) {
+	collectorFactories[name] = factory
+	collectorDefaults[name] = isDefaultEnabled
+}
+
+// collectorGroups assigns the collectors to the groups of the filtered handler.
+// Collectors not listed belong to the standard group.
+var collectorGroups = map[string]CollectorGroup{
+	"databases": CollectorGroupDatabases,
+	"views":     CollectorGroupViews,
+	"scheduler": CollectorGroupScheduler,
+}
+
+// collectorGroup returns the group of the filtered handler the collector belongs to
+func collectorGroup(name string) CollectorGroup {
+	if group, ok := collectorGroups[name]; ok {
+		return group
+	}
+	return CollectorGroupStandard
+}
+
+// CollectorNames returns the names of all available collectors in alphabetical order
+func CollectorNames() []string {
+	names := make([]string, 0, len(collectorFactories))
+	for name := range collectorFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CollectorEnabledByDefault tells whether the collector is enabled unless configured otherwise
+func CollectorEnabledByDefault(name string) bool {
+	return collectorDefaults[name]
+}
+
+// collectorEnabled resolves whether a collector is enabled. The views and scheduler collectors
+// additionally follow the older CollectViews and CollectSchedulerJobs settings.
+func (c CollectorConfig) collectorEnabled(name string) bool {
+	switch name {
+	case "views":
+		if !c.CollectViews {
+			return false
+		}
+	case "scheduler":
+		if c.CollectSchedulerJobs {
+			return true
+		}
+	}
+	if enabled, ok := c.Collectors[name]; ok {
+		return enabled
+	}
+	return collectorDefaults[name]
+}
+
+// anyCollectorEnabled tells whether at least one of the collectors is enabled
+func (c CollectorConfig) anyCollectorEnabled(names ...string) bool {
+	for _, name := range names {
+		if c.collectorEnabled(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// forGroups returns a copy of the config, which disables the collectors outside of the groups
+func (c CollectorConfig) forGroups(groups map[CollectorGroup]struct{}) CollectorConfig {
+	collectors := make(map[string]bool, len(c.Collectors))
+	for name, enabled := range c.Collectors {
+		collectors[name] = enabled
+	}
+	for _, name := range CollectorNames() {
+		if _, ok := groups[collectorGroup(name)]; !ok {
+			collectors[name] = false
+		}
+	}
+	c.Collectors = collectors
+	if _, ok := groups[CollectorGroupScheduler]; !ok {
+		c.CollectSchedulerJobs = false
+	}
+	return c
+}
+
+// newCollectors creates the enabled collectors by name
+func newCollectors(d *metricDescs, config CollectorConfig, logger *slog.Logger) map[string]Collector {
+	collectors := make(map[string]Collector)
+	for _, name := range CollectorNames() {
+		if config.collectorEnabled(name) {
+			collectors[name] = collectorFactories[name](d, logger)
+		}
+	}
+	return collectors
+}
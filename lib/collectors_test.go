@@ -0,0 +1,53 @@
+package lib
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestCollectorEnabled(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    CollectorConfig
+		collector string
+		expected  bool
+	}{
+		{"enabled by default", CollectorConfig{}, "node_stats", true},
+		{"disabled by default", CollectorConfig{}, "scheduler", false},
+		{"disabled explicitly", CollectorConfig{Collectors: map[string]bool{"node_stats": false}}, "node_stats", false},
+		{"enabled explicitly", CollectorConfig{Collectors: map[string]bool{"scheduler": true}}, "scheduler", true},
+		{"enabled by scheduler jobs", CollectorConfig{CollectSchedulerJobs: true, Collectors: map[string]bool{"scheduler": false}}, "scheduler", true},
+		{"views require collect views", CollectorConfig{Collectors: map[string]bool{"views": true}}, "views", false},
+		{"views with collect views", CollectorConfig{CollectViews: true}, "views", true},
+		{"views disabled explicitly", CollectorConfig{CollectViews: true, Collectors: map[string]bool{"views": false}}, "views", false},
+		{"unknown collector", CollectorConfig{}, "unknown", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := test.config.collectorEnabled(test.collector)
+			if actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNewCollectors(t *testing.T) {
+	descs := newMetricDescs(namespace, nil, MetricNamingLegacy)
+	standardDescs := len(descs.all)
+	collectors := newCollectors(descs, CollectorConfig{Collectors: map[string]bool{"mango": false}}, slog.Default())
+	if _, ok := collectors["mango"]; ok {
+		t.Error("expected no disabled mango collector")
+	}
+	if _, ok := collectors["node_stats"]; !ok {
+		t.Error("expected the node_stats collector")
+	}
+	if len(descs.all) <= standardDescs {
+		t.Error("expected the collectors to register their metric descriptions")
+	}
+	for _, desc := range descs.all {
+		if desc == nil {
+			t.Fatal("unexpected nil metric description")
+		}
+	}
+}
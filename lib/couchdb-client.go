@@ -1,8 +1,8 @@
 package lib
 
 import (
+	"context"
 	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -13,8 +13,26 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/gesellix/couchdb-prometheus-exporter/v30/couchmon"
+)
+
+// Semaphore weights of the requests per database; view queries are heavier for CouchDB than database infos
+const (
+	databaseInfoWeight = 1
+	designDocsWeight   = 1
+	viewQueryWeight    = 2
 )
 
+// nodeStatsCollectors are the collectors exporting the _stats of the nodes
+var nodeStatsCollectors = []string{"node_stats", "fabric", "replicator", "mango", "stats"}
+
+// defaultAdaptiveMaxConcurrency bounds the adaptive concurrency when no concurrency limit is configured
+const defaultAdaptiveMaxConcurrency = 32
+
 type BasicAuth struct {
 	Username string
 	Password string
@@ -25,209 +43,258 @@ type CouchdbClient struct {
 	BaseUri           string
 	basicAuth         BasicAuth
 	client            *http.Client
+	transport         *requestCountingRoundTripper
 	ResetRequestCount func()
 	GetRequestCount   func() int
+	logger            *slog.Logger
+
+	// limiter adapts the concurrent requests to CouchDB's health, nil if disabled
+	limiter *AdaptiveLimiter
+	// breakers pause the expensive collector groups after consecutive failures
+	breakers map[CollectorGroup]*CircuitBreaker
+	// semaphoreMetrics instrument the concurrency limits of the databases and views collectors, nil if disabled
+	semaphoreMetrics *SemaphoreMetrics
+	// mon decodes the responses of CouchDB, sending its requests through this client
+	mon *couchmon.Client
+	// nodeUris map the nodes to be scraped directly, instead of through the coordinator behind the BaseUri
+	nodeUris NodeUris
 }
 
-type HttpError struct {
-	Status     string
-	StatusCode int
-	RespBody   []byte
+type HttpError = couchmon.HttpError
+
+func (c *CouchdbClient) getNodeInfo(ctx context.Context) (NodeInfo, error) {
+	return c.mon.ServerInfo(ctx)
 }
 
-func (httpError *HttpError) Error() string {
-	return fmt.Errorf("status %s (%d): %s", httpError.Status, httpError.StatusCode, httpError.RespBody).Error()
+func (c *CouchdbClient) GetNodeNames(localOnly bool) ([]string, error) {
+	return c.getNodeNames(context.Background(), localOnly)
 }
 
-type MembershipResponse struct {
-	AllNodes     []string `json:"all_nodes"`
-	ClusterNodes []string `json:"cluster_nodes"`
-	SingleNode   string   `json:"name"`
+func (c *CouchdbClient) getNodeNames(ctx context.Context, localOnly bool) ([]string, error) {
+	return c.mon.NodeNames(ctx, localOnly)
 }
 
-func (c *CouchdbClient) getNodeInfo(uri string) (NodeInfo, error) {
-	data, err := c.Request("GET", fmt.Sprintf("%s/", uri), nil)
-	if err != nil {
-		return NodeInfo{}, err
+// getMembership returns the nodes of the cluster, or only the node behind the URI when scraping locally
+func (c *CouchdbClient) getMembership(ctx context.Context) (MembershipResponse, error) {
+	if !c.LocalOnly {
+		return c.mon.Membership(ctx)
 	}
-	var root NodeInfo
-	err = json.Unmarshal(data, &root)
+	nodeNames, err := c.getNodeNames(ctx, true)
 	if err != nil {
-		return NodeInfo{}, err
+		return MembershipResponse{}, err
 	}
-	return root, nil
+	return MembershipResponse{AllNodes: nodeNames, ClusterNodes: nodeNames}, nil
 }
 
-func (c *CouchdbClient) getServerVersion() (string, error) {
-	nodeInfo, err := c.getNodeInfo(c.BaseUri)
-	if err != nil {
-		return "", err
+// nodeClient returns the client for the node's endpoints and the node name to request them with,
+// which is "_local" when the node is scraped directly at its mapped URI
+func (c *CouchdbClient) nodeClient(name string) (*couchmon.Client, string) {
+	uri, ok := c.nodeUris.UriFor(name)
+	if !ok {
+		return c.mon, name
 	}
-	return nodeInfo.Version, nil
+	return couchmon.NewClient(uri, couchmon.WithRequester(c)), "_local"
 }
 
-func (c *CouchdbClient) isCouchDbV1() (bool, error) {
-	serverVersion, err := c.getServerVersion()
-	if err != nil {
-		return false, err
-	}
-
-	versionParts := strings.Split(serverVersion, ".")
-	major, err := strconv.Atoi(versionParts[0])
-	if err != nil {
-		return false, err
+// getNodeStats reads the stats of a node, or of the whole server for CouchDB 1.x
+func (c *CouchdbClient) getNodeStats(ctx context.Context, isCouchDbV1 bool, name string) (couchmon.StatsResponse, error) {
+	if isCouchDbV1 {
+		return c.mon.ServerStats(ctx)
 	}
-
-	return major < 2, nil
+	client, node := c.nodeClient(name)
+	return client.NodeStats(ctx, node)
 }
 
-func (c *CouchdbClient) GetNodeNames(localOnly bool) ([]string, error) {
-	var nodeDiscovery string = "_membership"
-	if localOnly {
-		nodeDiscovery = "_node/_local"
+// getNodeServerInfo reads the server info of a node, or of the whole server for CouchDB 1.x.
+// Nodes of a cluster are asked through the coordinator, which forwards the request to the node.
+func (c *CouchdbClient) getNodeServerInfo(ctx context.Context, isCouchDbV1 bool, name string) (NodeInfo, error) {
+	if isCouchDbV1 {
+		return c.mon.ServerInfo(ctx)
 	}
-	data, err := c.Request("GET", fmt.Sprintf("%s/%s", c.BaseUri, nodeDiscovery), nil)
-	if err != nil {
-		return nil, err
+	if _, direct := c.nodeUris.UriFor(name); direct {
+		client, _ := c.nodeClient(name)
+		return client.ServerInfo(ctx)
 	}
-	var membership MembershipResponse
-	err = json.Unmarshal(data, &membership)
-	if err != nil {
-		return nil, err
-	}
-	if localOnly {
-		membership.ClusterNodes = append(membership.ClusterNodes, membership.SingleNode)
-	}
-	// for i, name := range membership.ClusterNodes {
-	// 	slog.Infof("node[%d]: %s\n", i, name)
-	// }
-	return membership.ClusterNodes, nil
+	return c.mon.NodeServerInfo(ctx, name)
 }
 
-func (c *CouchdbClient) getNodeBaseUrisByNodeName(baseUri string) (map[string]string, error) {
-	names, err := c.GetNodeNames(c.LocalOnly)
-	if err != nil {
-		return nil, err
-	}
-	urisByNodeName := make(map[string]string)
-	for _, name := range names {
-		urisByNodeName[name] = fmt.Sprintf("%s/_node/%s", baseUri, name)
-	}
-	return urisByNodeName, nil
-}
+// getStatsByNodeName reads the stats of the nodes. The server info is read from each node, since the nodes' versions
+// might differ during a rolling upgrade; it stays unknown for nodes not answering it. CouchDB 3.2+ tells the runtime
+// versions of each node.
+// Nodes scraped directly are probed for their reachability, and are reported down instead of failing the scrape.
+func (c *CouchdbClient) getStatsByNodeName(ctx context.Context, serverInfo NodeInfo, nodeNames []string) (map[string]StatsResponse, error) {
+	isCouchDbV1 := !serverInfo.VersionAtLeast(2, 0)
 
-func (c *CouchdbClient) getStatsByNodeName(urisByNodeName map[string]string) (map[string]StatsResponse, error) {
 	statsByNodeName := make(map[string]StatsResponse)
-	for name, uri := range urisByNodeName {
+	for _, name := range nodeNames {
 		var stats StatsResponse
-		data, err := c.Request("GET", fmt.Sprintf("%s/_stats", uri), nil)
+		start := time.Now()
+		nodeStats, err := c.getNodeStats(ctx, isCouchDbV1, name)
+		if _, direct := c.nodeUris.UriFor(name); direct && !isCouchDbV1 {
+			stats.Probe = &NodeProbe{Reachable: err == nil, Duration: time.Since(start)}
+		}
 		if err != nil {
-			err = fmt.Errorf("error reading couchdb stats: %v", err)
-			if !strings.Contains(err.Error(), "\"error\":\"nodedown\"") {
+			err = fmt.Errorf("error reading couchdb stats: %w", err)
+			if !errors.Is(err, couchmon.ErrNodeDown) && stats.Probe == nil {
 				return nil, err
 			}
 
 			stats.Up = 0
-			slog.Error(fmt.Sprintf("continuing despite error: %v", err))
+			statsByNodeName[name] = stats
+			c.logger.Error(fmt.Sprintf("continuing despite error: %v", err))
 			continue
 		}
 
 		stats.Up = 1
+		stats.StatsResponse = nodeStats
 
-		err = json.Unmarshal(data, &stats)
+		nodeInfo, err := c.getNodeServerInfo(ctx, isCouchDbV1, name)
 		if err != nil {
-			return nil, fmt.Errorf("error unmarshalling stats for node %s: %v", name, err)
+			c.logger.Warn(fmt.Sprintf("error reading the server info of node %s: %v", name, err))
+		} else {
+			stats.NodeInfo = nodeInfo
 		}
-
-		// TODO this one is expected to retrieve other nodes' info
-		nodeInfo, err := c.getNodeInfo(c.BaseUri)
-		if err != nil {
-			return nil, err
+		if serverInfo.VersionAtLeast(3, 2) {
+			client, node := c.nodeClient(name)
+			versions, err := client.NodeVersions(ctx, node)
+			if err != nil {
+				c.logger.Warn(fmt.Sprintf("error reading the versions of node %s: %v", name, err))
+			} else {
+				stats.Versions = &versions
+			}
 		}
-		stats.NodeInfo = nodeInfo
 		statsByNodeName[name] = stats
 	}
 
-	if len(urisByNodeName) == 0 {
+	if len(nodeNames) == 0 {
 		return nil, fmt.Errorf("all nodes down")
 	}
 
 	return statsByNodeName, nil
 }
 
-func (c *CouchdbClient) getSystemByNodeName(urisByNodeName map[string]string) (map[string]SystemResponse, error) {
+func (c *CouchdbClient) getSystemByNodeName(ctx context.Context, nodeNames []string) (map[string]SystemResponse, error) {
 	systemByNodeName := make(map[string]SystemResponse)
-	for name, uri := range urisByNodeName {
-		var stats SystemResponse
-
-		data, err := c.Request("GET", fmt.Sprintf("%s/_system", uri), nil)
+	for _, name := range nodeNames {
+		client, node := c.nodeClient(name)
+		stats, err := client.NodeSystem(ctx, node)
 		if err != nil {
-			err = fmt.Errorf("error reading couchdb system stats: %v", err)
-			if !strings.Contains(err.Error(), "\"error\":\"nodedown\"") {
+			err = fmt.Errorf("error reading couchdb system stats: %w", err)
+			if _, direct := c.nodeUris.UriFor(name); !direct && !errors.Is(err, couchmon.ErrNodeDown) {
 				return nil, err
 			}
-			slog.Error(fmt.Sprintf("continuing despite error: %v", err))
+			c.logger.Error(fmt.Sprintf("continuing despite error: %v", err))
 			continue
 		}
 
-		err = json.Unmarshal(data, &stats)
-		if err != nil {
-			return nil, fmt.Errorf("error unmarshalling system stats for node %s: %v", name, err)
-		}
-
 		systemByNodeName[name] = stats
 	}
 
-	if len(urisByNodeName) == 0 {
+	if len(nodeNames) == 0 {
 		return nil, fmt.Errorf("all nodes down")
 	}
 
 	return systemByNodeName, nil
 }
 
-func (c *CouchdbClient) getStats(config CollectorConfig) (Stats, error) {
-	isCouchDbV1, err := c.isCouchDbV1()
+// phaseTimings records the durations of the phases of a scrape
+type phaseTimings map[string]time.Duration
+
+// track adds the time since start to the phase
+func (t phaseTimings) track(phase string, start time.Time) {
+	if t != nil {
+		t[phase] += time.Since(start)
+	}
+}
+
+func (c *CouchdbClient) getStats(ctx context.Context, config CollectorConfig, timings phaseTimings) (Stats, error) {
+	start := time.Now()
+	serverInfo, err := c.getNodeInfo(ctx)
+	timings.track("version", start)
+	if err != nil {
+		return c.getStatsFromNodes(ctx, config, timings, err)
+	}
+	major, err := serverInfo.MajorVersion()
 	if err != nil {
 		return Stats{}, err
 	}
+	isCouchDbV1 := major < 2
+	collectNodeMetrics := config.DatabaseShard.EmitsNodeMetrics()
+	collectNodeStats := collectNodeMetrics && config.anyCollectorEnabled(nodeStatsCollectors...)
+	collectDatabasesTotal := collectNodeMetrics && config.collectorEnabled("databases")
+	collectActiveTasks := collectNodeMetrics && config.collectorEnabled("active_tasks")
 	if !isCouchDbV1 {
-		urisByNode, err := c.getNodeBaseUrisByNodeName(c.BaseUri)
-		if err != nil {
-			return Stats{}, err
+		collectSystem := collectNodeMetrics && config.collectorEnabled("system")
+		var membership MembershipResponse
+		var nodeStats map[string]StatsResponse
+		if collectNodeStats || collectSystem {
+			start = time.Now()
+			membership, err = c.getMembership(ctx)
+			timings.track("membership", start)
+			if err != nil {
+				return Stats{}, err
+			}
 		}
-		nodeStats, err := c.getStatsByNodeName(urisByNode)
-		if err != nil {
-			return Stats{}, err
+		nodeNames := membership.ClusterNodes
+		if collectNodeStats {
+			start = time.Now()
+			nodeStats, err = c.getStatsByNodeName(ctx, serverInfo, nodeNames)
+			timings.track("node_stats", start)
+			if err != nil {
+				return Stats{}, err
+			}
 		}
-		databaseStats, err := c.getDatabasesStatsByDbName(config.ObservedDatabases, config.ConcurrentRequests)
+		databaseStats, err := c.getDatabaseAndViewStats(ctx, config, timings)
 		if err != nil {
 			return Stats{}, err
 		}
-		if config.CollectViews {
-			err := c.enhanceWithViewUpdateSeq(isCouchDbV1, databaseStats, config.ConcurrentRequests)
+		if !collectNodeMetrics {
+			return Stats{
+				DatabaseStatsByDbName: databaseStats,
+				ApiVersion:            "2"}, nil
+		}
+		schedulerJobs := SchedulerJobsResponse{}
+		if config.collectorEnabled("scheduler") {
+			start = time.Now()
+			schedulerJobs, err = c.getSchedulerJobs(ctx)
+			timings.track("scheduler", start)
+		}
+		var activeTasks ActiveTasksResponse
+		if collectActiveTasks {
+			start = time.Now()
+			activeTasks, err = c.getActiveTasks(ctx, c.LocalOnly)
+			timings.track("active_tasks", start)
 			if err != nil {
 				return Stats{}, err
 			}
 		}
-		schedulerJobs := SchedulerJobsResponse{}
-		if config.CollectSchedulerJobs {
-			schedulerJobs, err = c.getSchedulerJobs()
-		}
-		activeTasks, err := c.getActiveTasks(c.LocalOnly)
-		if err != nil {
-			return Stats{}, err
+		var databasesList []string
+		if collectDatabasesTotal {
+			start = time.Now()
+			databasesList, err = c.getDatabaseList(ctx)
+			timings.track("all_dbs", start)
+			if err != nil {
+				return Stats{}, err
+			}
 		}
-		databasesList, err := c.getDatabaseList()
-		if err != nil {
-			return Stats{}, err
+		var systemStats map[string]SystemResponse
+		if collectSystem {
+			start = time.Now()
+			systemStats, err = c.getSystemByNodeName(ctx, nodeNames)
+			timings.track("system", start)
+			if err != nil {
+				return Stats{}, err
+			}
 		}
-		systemStats, err := c.getSystemByNodeName(urisByNode)
-		if err != nil {
-			return Stats{}, err
+
+		var clusterMembership *MembershipResponse
+		if (collectNodeStats || collectSystem) && !c.LocalOnly {
+			clusterMembership = &membership
 		}
 
 		return Stats{
 			StatsByNodeName:       nodeStats,
+			Membership:            clusterMembership,
 			DatabasesTotal:        len(databasesList),
 			DatabaseStatsByDbName: databaseStats,
 			ActiveTasksResponse:   activeTasks,
@@ -235,30 +302,41 @@ func (c *CouchdbClient) getStats(config CollectorConfig) (Stats, error) {
 			SystemByNodeName:      systemStats,
 			ApiVersion:            "2"}, nil
 	} else {
-		urisByNode := map[string]string{
-			"master": c.BaseUri,
+		var nodeStats map[string]StatsResponse
+		if collectNodeStats {
+			start = time.Now()
+			nodeStats, err = c.getStatsByNodeName(ctx, serverInfo, []string{"master"})
+			timings.track("node_stats", start)
+			if err != nil {
+				return Stats{}, err
+			}
 		}
-		nodeStats, err := c.getStatsByNodeName(urisByNode)
+		databaseStats, err := c.getDatabaseAndViewStats(ctx, config, timings)
 		if err != nil {
 			return Stats{}, err
 		}
-		databaseStats, err := c.getDatabasesStatsByDbName(config.ObservedDatabases, config.ConcurrentRequests)
-		if err != nil {
-			return Stats{}, err
+		if !collectNodeMetrics {
+			return Stats{
+				DatabaseStatsByDbName: databaseStats,
+				ApiVersion:            "1"}, nil
 		}
-		if config.CollectViews {
-			err := c.enhanceWithViewUpdateSeq(isCouchDbV1, databaseStats, config.ConcurrentRequests)
+		var activeTasks ActiveTasksResponse
+		if collectActiveTasks {
+			start = time.Now()
+			activeTasks, err = c.getActiveTasks(ctx, false)
+			timings.track("active_tasks", start)
 			if err != nil {
 				return Stats{}, err
 			}
 		}
-		activeTasks, err := c.getActiveTasks(false)
-		if err != nil {
-			return Stats{}, err
-		}
-		databasesList, err := c.getDatabaseList()
-		if err != nil {
-			return Stats{}, err
+		var databasesList []string
+		if collectDatabasesTotal {
+			start = time.Now()
+			databasesList, err = c.getDatabaseList(ctx)
+			timings.track("all_dbs", start)
+			if err != nil {
+				return Stats{}, err
+			}
 		}
 		return Stats{
 			StatsByNodeName:       nodeStats,
@@ -269,50 +347,126 @@ func (c *CouchdbClient) getStats(config CollectorConfig) (Stats, error) {
 	}
 }
 
+// getStatsFromNodes reads the node stats directly from the statically mapped nodes, while the coordinator behind the URI fails.
+// The stats of the databases, active tasks and scheduler jobs need the coordinator and are omitted.
+func (c *CouchdbClient) getStatsFromNodes(ctx context.Context, config CollectorConfig, timings phaseTimings, coordinatorErr error) (Stats, error) {
+	nodeNames := c.nodeUris.StaticNodeNames()
+	if len(nodeNames) == 0 || !config.DatabaseShard.EmitsNodeMetrics() {
+		return Stats{}, coordinatorErr
+	}
+	c.logger.Warn(fmt.Sprintf("reading the node stats directly from the nodes, since the coordinator failed: %v", coordinatorErr))
+
+	start := time.Now()
+	var serverInfo NodeInfo
+	for _, name := range nodeNames {
+		client, _ := c.nodeClient(name)
+		info, err := client.ServerInfo(ctx)
+		if err == nil && info.VersionAtLeast(2, 0) {
+			serverInfo = info
+			break
+		}
+	}
+	timings.track("version", start)
+	if serverInfo.Version == "" {
+		return Stats{}, coordinatorErr
+	}
+
+	stats := Stats{ApiVersion: "2"}
+	var err error
+	if config.anyCollectorEnabled(nodeStatsCollectors...) {
+		start = time.Now()
+		stats.StatsByNodeName, err = c.getStatsByNodeName(ctx, serverInfo, nodeNames)
+		timings.track("node_stats", start)
+		if err != nil {
+			return Stats{}, err
+		}
+	}
+	if config.collectorEnabled("system") {
+		start = time.Now()
+		stats.SystemByNodeName, err = c.getSystemByNodeName(ctx, nodeNames)
+		timings.track("system", start)
+		if err != nil {
+			return Stats{}, err
+		}
+	}
+	return stats, nil
+}
+
+// getDatabaseAndViewStats collects the stats of the observed databases and, if configured, their views.
+// Groups with an open circuit breaker are skipped.
+func (c *CouchdbClient) getDatabaseAndViewStats(ctx context.Context, config CollectorConfig, timings phaseTimings) (map[string]DatabaseStats, error) {
+	if !config.anyCollectorEnabled("databases", "views") {
+		return map[string]DatabaseStats{}, nil
+	}
+	databasesBreaker := c.breakers[CollectorGroupDatabases]
+	if !databasesBreaker.Allow() {
+		c.logger.Warn("circuit breaker open, skipping database stats", "collector", CollectorGroupDatabases)
+		return map[string]DatabaseStats{}, nil
+	}
+	start := time.Now()
+	databaseStats, err := c.getDatabasesStatsByDbName(ctx, config.ObservedDatabases, config.ConcurrentRequests)
+	timings.track("databases", start)
+	if err != nil {
+		databasesBreaker.Failure()
+		return nil, err
+	}
+	databasesBreaker.Success()
+
+	if config.collectorEnabled("views") {
+		viewsBreaker := c.breakers[CollectorGroupViews]
+		if !viewsBreaker.Allow() {
+			c.logger.Warn("circuit breaker open, skipping view stats", "collector", CollectorGroupViews)
+			return databaseStats, nil
+		}
+		start = time.Now()
+		err := c.enhanceWithViewUpdateSeq(ctx, databaseStats, config.ConcurrentRequests)
+		timings.track("views", start)
+		if err != nil {
+			viewsBreaker.Failure()
+			return nil, err
+		}
+		viewsBreaker.Success()
+	}
+	return databaseStats, nil
+}
+
+// CircuitOpenByCollector returns the state of each circuit breaker, empty if circuit breaking is disabled
+func (c *CouchdbClient) CircuitOpenByCollector() map[CollectorGroup]bool {
+	circuitOpen := make(map[CollectorGroup]bool, len(c.breakers))
+	for group, breaker := range c.breakers {
+		circuitOpen[group] = breaker.IsOpen()
+	}
+	return circuitOpen
+}
+
 type dbStatsResult struct {
 	dbName  string
 	dbStats DatabaseStats
 	err     error
 }
 
-func (c *CouchdbClient) getDatabasesStatsByDbName(databases []string, concurrency uint) (map[string]DatabaseStats, error) {
+func (c *CouchdbClient) getDatabasesStatsByDbName(ctx context.Context, databases []string, concurrency uint) (map[string]DatabaseStats, error) {
 	dbStatsByDbName := make(map[string]DatabaseStats)
 	// Setup for concurrent scatter/gather scrapes, with concurrency limit
 	r := make(chan dbStatsResult, len(databases))
-	semaphore := NewSemaphore(concurrency) // semaphore to limit concurrency
+	semaphore := NewInstrumentedSemaphore(concurrency, string(CollectorGroupDatabases), c.semaphoreMetrics) // semaphore to limit concurrency
 
 	// scatter
 	for _, dbName := range databases {
 		dbName := dbName // rebind for closure to capture the value
-		escapedDbName := url.QueryEscape(dbName)
 		go func() {
-			err := semaphore.Acquire()
+			err := semaphore.AcquireWeighted(ctx, databaseInfoWeight)
 			if err != nil {
+				r <- dbStatsResult{err: fmt.Errorf("aborted reading database '%s' stats: %v", dbName, err)}
 				return
 			}
-			var dbStats DatabaseStats
-			data, err := c.Request("GET", fmt.Sprintf("%s/%s", c.BaseUri, escapedDbName), nil)
-			semaphore.Release()
+			dbInfo, err := c.mon.DatabaseInfo(ctx, dbName)
+			semaphore.ReleaseWeighted(databaseInfoWeight)
 			if err != nil {
 				r <- dbStatsResult{err: fmt.Errorf("error reading database '%s' stats: %v", dbName, err)}
 				return
 			}
-
-			err = json.Unmarshal(data, &dbStats)
-			if err != nil {
-				r <- dbStatsResult{err: fmt.Errorf("error unmarshalling database '%s' stats: %v", dbName, err)}
-				return
-			}
-			if dbStats.DiskSize == 0 && dbStats.Sizes.File > 0 {
-				dbStats.DiskSizeOverhead = dbStats.Sizes.File - dbStats.Sizes.Active
-			} else {
-				dbStats.DiskSizeOverhead = dbStats.DiskSize - dbStats.DataSize
-			}
-			if dbStats.CompactRunningBool {
-				dbStats.CompactRunning = 1
-			} else {
-				dbStats.CompactRunning = 0
-			}
+			dbStats := DatabaseStats{DatabaseInfo: dbInfo}
 			r <- dbStatsResult{dbName, dbStats, nil}
 		}()
 	}
@@ -335,97 +489,33 @@ type viewStats struct {
 	err       error
 }
 
-func (c *CouchdbClient) viewStats(isCouchdbV1 bool, dbName string, designDocId string, viewName string) viewStats {
-	escapedDbName := url.QueryEscape(dbName)
-
-	query := strings.Join([]string{
-		"stale=ok",
-		"update=false",
-		"stable=true",
-		"update_seq=true",
-		"include_docs=false",
-		"limit=0",
-	}, "&")
-	var viewDoc ViewResponse
-	viewDocData, err := c.Request("GET", fmt.Sprintf("%s/%s/%s/_view/%s?%s", c.BaseUri, escapedDbName, designDocId, viewName, query), nil)
+func (c *CouchdbClient) viewStats(ctx context.Context, dbName string, designDocId string, viewName string) viewStats {
+	updateSeq, err := c.mon.ViewUpdateSeq(ctx, dbName, designDocId, viewName)
 	if err != nil {
-		if httpError, ok := err.(*HttpError); ok == true {
-			err = json.Unmarshal(httpError.RespBody, &viewDoc)
-			if err != nil {
-				return viewStats{err: fmt.Errorf("error unmarshalling http error response when requesting view '%s/%s/_view/%s': %v", dbName, designDocId, viewName, err)}
-			}
-			if viewDoc.Error != "" {
-				return viewStats{err: fmt.Errorf("error reading view '%s/%s/_view/%s': %v", dbName, designDocId, viewName, errors.New(fmt.Sprintf("%s, reason: %s", viewDoc.Error, viewDoc.Reason)))}
-			}
-		}
-		return viewStats{err: fmt.Errorf("error reading view '%s/%s/_view/%s': %v", dbName, designDocId, viewName, errors.New(fmt.Sprintf("%s, reason: %s", viewDoc.Error, viewDoc.Reason)))}
-	}
-	err = json.Unmarshal(viewDocData, &viewDoc)
-	if err != nil {
-		return viewStats{err: fmt.Errorf("error unmarshalling view doc for view '%s/%s/_view/%s': %v", dbName, designDocId, viewName, err)}
-	}
-	if viewDoc.Error != "" {
-		return viewStats{err: fmt.Errorf("error reading view '%s/%s/_view/%s': %v", dbName, designDocId, viewName, errors.New(fmt.Sprintf("%s, reason: %s", viewDoc.Error, viewDoc.Reason)))}
-	}
-
-	var updateSeq string
-	if isCouchdbV1 {
-		updateSeq = c.updateSeqFromInt(viewDoc.UpdateSeq)
-	} else {
-		updateSeq = c.updateSeqFromString(viewDoc.UpdateSeq)
+		return viewStats{err: fmt.Errorf("error reading view '%s/%s/_view/%s': %w", dbName, designDocId, viewName, err)}
 	}
 	return viewStats{viewName, updateSeq, "", nil}
 }
 
-func (c *CouchdbClient) updateSeqFromInt(message json.RawMessage) string {
-	var updateSeq int64
-	err := json.Unmarshal(message, &updateSeq)
-	if err != nil {
-		slog.Warn(fmt.Sprintf("%v", err))
-	}
-	return strconv.FormatInt(updateSeq, 10)
-}
-
-func (c *CouchdbClient) updateSeqFromString(message json.RawMessage) string {
-	var updateSeq string
-	err := json.Unmarshal(message, &updateSeq)
-	if err != nil {
-		slog.Warn(fmt.Sprintf("%v", err))
-	}
-	return updateSeq
-}
-
-func (c *CouchdbClient) enhanceWithViewUpdateSeq(isCouchdbV1 bool, dbStatsByDbName map[string]DatabaseStats, concurrency uint) error {
+func (c *CouchdbClient) enhanceWithViewUpdateSeq(ctx context.Context, dbStatsByDbName map[string]DatabaseStats, concurrency uint) error {
 	// Setup for concurrent scatter/gather scrapes, with concurrency limit
 	r := make(chan dbStatsResult, len(dbStatsByDbName))
-	semaphore := NewSemaphore(concurrency) // semaphore to limit concurrency
+	semaphore := NewInstrumentedSemaphore(concurrency, string(CollectorGroupViews), c.semaphoreMetrics) // semaphore to limit concurrency
 
 	// scatter
 	for dbName, dbStats := range dbStatsByDbName {
 		dbName := dbName   // rebind for closure to capture the value
 		dbStats := dbStats // rebind for closure to capture the value
-		escapedDbName := url.QueryEscape(dbName)
 		go func() {
-			err := semaphore.Acquire()
-			if err != nil {
-				return
-			}
-			query := strings.Join([]string{
-				"startkey=\"_design/\"",
-				"endkey=\"_design0\"",
-				"include_docs=true",
-			}, "&")
-			designDocData, err := c.Request("GET", fmt.Sprintf("%s/%s/_all_docs?%s", c.BaseUri, escapedDbName, query), nil)
-			semaphore.Release()
+			err := semaphore.AcquireWeighted(ctx, designDocsWeight)
 			if err != nil {
-				r <- dbStatsResult{err: fmt.Errorf("error reading database '%s' stats: %v", dbName, err)}
+				r <- dbStatsResult{err: fmt.Errorf("aborted design docs of database '%s': %v", dbName, err)}
 				return
 			}
-
-			var designDocs DocsResponse
-			err = json.Unmarshal(designDocData, &designDocs)
+			designDocs, err := c.mon.DesignDocs(ctx, dbName)
+			semaphore.ReleaseWeighted(designDocsWeight)
 			if err != nil {
-				r <- dbStatsResult{err: fmt.Errorf("error unmarshalling design docs for database '%s': %v", dbName, err)}
+				r <- dbStatsResult{err: fmt.Errorf("error reading design docs of database '%s': %v", dbName, err)}
 				return
 			}
 			views := make(ViewStatsByDesignDocName)
@@ -448,14 +538,14 @@ func (c *CouchdbClient) enhanceWithViewUpdateSeq(isCouchdbV1 bool, dbStatsByDbNa
 						}
 						go func() {
 							//slog.Infof("/%s/%s/_view/%s\n", dbName, row.Doc.Id, viewName)
-							err := semaphore.Acquire()
+							err := semaphore.AcquireWeighted(ctx, viewQueryWeight)
 							if err != nil {
 								// send something to parent coroutine so it doesn't block forever on receive
 								v <- viewStats{err: fmt.Errorf("aborted view stats for /%s/%s/_view/%s", dbName, row.Doc.Id, viewName)}
 								return
 							}
-							defer semaphore.Release()
-							v <- c.viewStats(isCouchdbV1, dbName, row.Doc.Id, viewName)
+							defer semaphore.ReleaseWeighted(viewQueryWeight)
+							v <- c.viewStats(ctx, dbName, row.Doc.Id, viewName)
 						}()
 					}
 					for range row.Doc.Views {
@@ -466,7 +556,7 @@ func (c *CouchdbClient) enhanceWithViewUpdateSeq(isCouchdbV1 bool, dbStatsByDbNa
 						}
 						if res.err != nil {
 							// TODO consider adding a metric to make errors more visible
-							slog.Error(fmt.Sprintf("%v", res.err))
+							c.logger.Error(fmt.Sprintf("%v", res.err))
 							continue
 							//r <- dbStatsResult{err: res.err}
 							//return
@@ -503,69 +593,33 @@ func (c *CouchdbClient) enhanceWithViewUpdateSeq(isCouchdbV1 bool, dbStatsByDbNa
 }
 
 // CouchDB 2.x+ only
-func (c *CouchdbClient) getSchedulerJobs() (SchedulerJobsResponse, error) {
-	data, err := c.Request("GET", fmt.Sprintf("%s/_scheduler/jobs", c.BaseUri), nil)
+func (c *CouchdbClient) getSchedulerJobs(ctx context.Context) (SchedulerJobsResponse, error) {
+	schedulerJobs, err := c.mon.SchedulerJobs(ctx)
 	if err != nil {
 		return SchedulerJobsResponse{}, fmt.Errorf("error reading scheduler jobs: %v", err)
 	}
-
-	var schedulerJobs SchedulerJobsResponse
-	err = json.Unmarshal(data, &schedulerJobs)
-	if err != nil {
-		return SchedulerJobsResponse{}, fmt.Errorf("error unmarshalling scheduler jobs: %v", err)
-	}
-	//for _, job := range schedulerJobs.Jobs {
-	//	replDoc, err := c.Request("GET", fmt.Sprintf("%s/%s/%s", c.BaseUri, job.Database, job.DocID), nil)
-	//	if err != nil {
-	//		return SchedulerJobsResponse{}, fmt.Errorf("error reading replication doc '%s/%s': %v", job.Database, job.DocID, err)
-	//	}
-	//}
 	return schedulerJobs, nil
 }
 
-func (c *CouchdbClient) getActiveTasks(localOnly bool) (ActiveTasksResponse, error) {
-	var tasksDiscovery string = "_active_tasks"
-	if localOnly {
-		tasksDiscovery = "_node/_local/_active_tasks"
-	}
-	data, err := c.Request("GET", fmt.Sprintf("%s/%s", c.BaseUri, tasksDiscovery), nil)
+func (c *CouchdbClient) getActiveTasks(ctx context.Context, localOnly bool) (ActiveTasksResponse, error) {
+	activeTasks, err := c.mon.ActiveTasks(ctx, localOnly)
 	if err != nil {
 		return ActiveTasksResponse{}, fmt.Errorf("error reading active tasks: %v", err)
 	}
-
-	var activeTasks ActiveTasksResponse
-	err = json.Unmarshal(data, &activeTasks)
-	if err != nil {
-		return ActiveTasksResponse{}, fmt.Errorf("error unmarshalling active tasks: %v", err)
-	}
-	for _, activeTask := range activeTasks {
-		// CouchDB 1.x doesn't know anything about nodes.
-		if activeTask.Node == "" {
-			if localOnly {
-				activeTask.Node = "_local"
-			} else {
-				activeTask.Node = "master"
-			}
-		}
-	}
 	return activeTasks, nil
 }
 
-func (c *CouchdbClient) getDatabaseList() ([]string, error) {
-	data, err := c.Request("GET", fmt.Sprintf("%s/%s", c.BaseUri, AllDbs), nil)
-	if err != nil {
-		return nil, err
-	}
-	var dbs []string
-	err = json.Unmarshal(data, &dbs)
-	if err != nil {
-		return nil, err
-	}
-	return dbs, nil
+func (c *CouchdbClient) getDatabaseList(ctx context.Context) ([]string, error) {
+	return c.mon.AllDbs(ctx)
 }
 
 func (c *CouchdbClient) Request(method string, uri string, body io.Reader) (respData []byte, err error) {
-	req, err := http.NewRequest(method, uri, body)
+	return c.RequestWithContext(context.Background(), method, uri, body)
+}
+
+// RequestWithContext sends a request to CouchDB, which is cancelled when the context is done
+func (c *CouchdbClient) RequestWithContext(ctx context.Context, method string, uri string, body io.Reader) (respData []byte, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
 	if err != nil {
 		return nil, err
 	}
@@ -578,10 +632,17 @@ func (c *CouchdbClient) Request(method string, uri string, body io.Reader) (resp
 		req.SetBasicAuth(c.basicAuth.Username, c.basicAuth.Password)
 	}
 
+	err = c.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
 	resp, err := c.client.Do(req)
 	if err != nil {
+		c.limiter.Release(time.Since(start), 0)
 		return nil, err
 	}
+	c.limiter.Release(time.Since(start), resp.StatusCode)
 	if resp != nil {
 		defer func() {
 			if cerr := resp.Body.Close(); cerr != nil {
@@ -595,7 +656,9 @@ func (c *CouchdbClient) Request(method string, uri string, body io.Reader) (resp
 		if err != nil {
 			respData = []byte(err.Error())
 		}
-		return nil, &HttpError{resp.Status, resp.StatusCode, respData}
+		httpError := couchmon.NewHttpError(resp.Status, resp.StatusCode, respData)
+		c.transport.countError(req.URL, httpError)
+		return nil, httpError
 	}
 	if err != nil {
 		return nil, err
@@ -603,34 +666,184 @@ func (c *CouchdbClient) Request(method string, uri string, body io.Reader) (resp
 	return respData, nil
 }
 
+// RequestMetrics instrument the requests to CouchDB per normalized endpoint
+type RequestMetrics struct {
+	DurationSeconds *prometheus.HistogramVec
+	ResponseBytes   *prometheus.HistogramVec
+	// Errors counts CouchDB's error responses per endpoint and CouchDB error, nil if disabled
+	Errors *prometheus.CounterVec
+}
+
 type requestCountingRoundTripper struct {
 	RequestCount int64
 	rt           http.RoundTripper
+	basePath     string
+	metrics      *RequestMetrics
 }
 
 func (rt *requestCountingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	atomic.AddInt64(&rt.RequestCount, 1)
 	//slog.Infof("req[%d] %s", atomic.LoadInt64(&rt.RequestCount), req.URL.String())
-	return rt.rt.RoundTrip(req)
+	if rt.metrics == nil {
+		return rt.rt.RoundTrip(req)
+	}
+	endpoint := normalizeEndpoint(rt.basePath, req.URL)
+	start := time.Now()
+	resp, err := rt.rt.RoundTrip(req)
+	if err != nil {
+		rt.metrics.DurationSeconds.WithLabelValues(endpoint, req.Method, "error").Observe(time.Since(start).Seconds())
+		return resp, err
+	}
+	resp.Body = &instrumentedBody{
+		ReadCloser: resp.Body,
+		observe: func(size int64) {
+			code := strconv.Itoa(resp.StatusCode)
+			rt.metrics.DurationSeconds.WithLabelValues(endpoint, req.Method, code).Observe(time.Since(start).Seconds())
+			rt.metrics.ResponseBytes.WithLabelValues(endpoint, req.Method, code).Observe(float64(size))
+		},
+	}
+	return resp, nil
+}
+
+// countError counts an error response of CouchDB by its endpoint and error name
+func (rt *requestCountingRoundTripper) countError(u *url.URL, httpError *HttpError) {
+	if rt.metrics == nil || rt.metrics.Errors == nil {
+		return
+	}
+	rt.metrics.Errors.WithLabelValues(normalizeEndpoint(rt.basePath, u), httpError.Label()).Inc()
+}
+
+// instrumentedBody counts the bytes read from a response body, observing them once the body is closed
+type instrumentedBody struct {
+	io.ReadCloser
+	size    int64
+	once    sync.Once
+	observe func(size int64)
+}
+
+func (b *instrumentedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	return n, err
+}
+
+func (b *instrumentedBody) Close() error {
+	b.once.Do(func() {
+		b.observe(b.size)
+	})
+	return b.ReadCloser.Close()
+}
+
+// serverEndpoints are the top level endpoints of CouchDB. Other paths starting with "_" are system databases,
+// like _users or _replicator.
+var serverEndpoints = map[string]bool{
+	"_active_tasks":  true,
+	"_all_dbs":       true,
+	"_cluster_setup": true,
+	"_config":        true,
+	"_db_updates":    true,
+	"_dbs_info":      true,
+	"_membership":    true,
+	"_node":          true,
+	"_replicate":     true,
+	"_reshard":       true,
+	"_scheduler":     true,
+	"_session":       true,
+	"_stats":         true,
+	"_system":        true,
+	"_up":            true,
+	"_utils":         true,
+	"_uuids":         true,
+}
+
+// normalizeEndpoint maps request URLs to a bounded set of endpoint names, omitting database, node and view names
+func normalizeEndpoint(basePath string, u *url.URL) string {
+	path := strings.TrimPrefix(u.EscapedPath(), strings.TrimSuffix(basePath, "/"))
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "server_info"
+	}
+	segments := strings.Split(path, "/")
+	switch {
+	case segments[0] == "_node" && len(segments) == 2:
+		return "node_info"
+	case segments[0] == "_node":
+		return strings.Join(segments[2:], "_")
+	case segments[0] == "_scheduler":
+		return strings.Join(segments, "_")
+	case serverEndpoints[segments[0]]:
+		return segments[0]
+	case len(segments) == 1:
+		return "db_info"
+	case segments[1] == "_all_docs" && strings.Contains(u.RawQuery, "_design"):
+		return "_all_docs_design"
+	case segments[1] == "_all_docs":
+		return "_all_docs"
+	case len(segments) == 5 && segments[1] == "_design" && segments[3] == "_view":
+		return "view_query"
+	default:
+		return "other"
+	}
+}
+
+// enableLoadProtection sets up the adaptive concurrency limit and the circuit breakers, as configured
+func (c *CouchdbClient) enableLoadProtection(config CollectorConfig) {
+	if config.AdaptiveConcurrency {
+		maxConcurrency := config.ConcurrentRequests
+		if maxConcurrency == 0 {
+			maxConcurrency = defaultAdaptiveMaxConcurrency
+		}
+		c.limiter = NewAdaptiveLimiter(maxConcurrency, config.AdaptiveLatencyThreshold)
+	}
+	if config.CircuitBreakerFailures > 0 {
+		c.breakers = map[CollectorGroup]*CircuitBreaker{
+			CollectorGroupDatabases: NewCircuitBreaker(config.CircuitBreakerFailures, config.CircuitBreakerCooldown),
+			CollectorGroupViews:     NewCircuitBreaker(config.CircuitBreakerFailures, config.CircuitBreakerCooldown),
+		}
+	}
 }
 
 func NewCouchdbClient(uri string, localOnly bool, basicAuth BasicAuth, insecure bool) *CouchdbClient {
-	countingRoundTripper := &requestCountingRoundTripper{
-		0,
-		&http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
-		},
+	return newCouchdbClient(newOptions(
+		WithURI(uri),
+		WithLocalOnly(localOnly),
+		WithBasicAuth(basicAuth.Username, basicAuth.Password),
+		WithInsecure(insecure)))
+}
+
+func newCouchdbClient(o *options) *CouchdbClient {
+	var rt http.RoundTripper = &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: o.insecure},
+	}
+	httpClient := &http.Client{}
+	if o.httpClient != nil {
+		// copy the client, so that wrapping its transport doesn't affect other users
+		client := *o.httpClient
+		httpClient = &client
+		rt = http.DefaultTransport
+		if httpClient.Transport != nil {
+			rt = httpClient.Transport
+		}
+	}
+	if o.roundTripper != nil {
+		rt = o.roundTripper
 	}
 
-	httpClient := &http.Client{
-		Transport: countingRoundTripper,
+	countingRoundTripper := &requestCountingRoundTripper{
+		rt: rt,
+	}
+	if baseUrl, err := url.Parse(o.uri); err == nil {
+		countingRoundTripper.basePath = baseUrl.EscapedPath()
 	}
+	httpClient.Transport = countingRoundTripper
 
-	return &CouchdbClient{
-		BaseUri:   uri,
-		LocalOnly: localOnly,
-		basicAuth: basicAuth,
+	c := &CouchdbClient{
+		BaseUri:   o.uri,
+		LocalOnly: o.localOnly,
+		basicAuth: o.basicAuth,
 		client:    httpClient,
+		transport: countingRoundTripper,
+		logger:    o.logger,
 		ResetRequestCount: func() {
 			atomic.StoreInt64(&countingRoundTripper.RequestCount, 0)
 		},
@@ -638,4 +851,6 @@ func NewCouchdbClient(uri string, localOnly bool, basicAuth BasicAuth, insecure
 			return int(atomic.LoadInt64(&countingRoundTripper.RequestCount))
 		},
 	}
+	c.mon = couchmon.NewClient(o.uri, couchmon.WithRequester(c))
+	return c
 }
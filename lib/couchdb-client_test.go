@@ -1 +1,111 @@
 package lib
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/gesellix/couchdb-prometheus-exporter/v30/couchmon"
+)
+
+func TestNormalizeEndpoint(t *testing.T) {
+	tests := []struct {
+		basePath string
+		uri      string
+		expected string
+	}{
+		{"", "/", "server_info"},
+		{"", "/_membership", "_membership"},
+		{"", "/_all_dbs", "_all_dbs"},
+		{"", "/_active_tasks", "_active_tasks"},
+		{"", "/_scheduler/jobs", "_scheduler_jobs"},
+		{"", "/_node/_local", "node_info"},
+		{"", "/_node/_local/_active_tasks", "_active_tasks"},
+		{"", "/_node/couchdb@127.0.0.1/_stats", "_stats"},
+		{"", "/_node/couchdb@127.0.0.1/_system", "_system"},
+		{"", "/_stats", "_stats"},
+		{"", "/_up", "_up"},
+		{"", "/_users", "db_info"},
+		{"", "/_replicator", "db_info"},
+		{"", "/_users/_all_docs?startkey=\"_design/\"&endkey=\"_design0\"&include_docs=true", "_all_docs_design"},
+		{"", "/_replicator/_design/_replicator/_view/by_id?limit=0", "view_query"},
+		{"", "/example", "db_info"},
+		{"", "/a%2Fb", "db_info"},
+		{"", "/example/_all_docs?startkey=\"_design/\"&endkey=\"_design0\"&include_docs=true", "_all_docs_design"},
+		{"", "/example/_all_docs", "_all_docs"},
+		{"", "/example/_design/views/_view/by_id?limit=0", "view_query"},
+		{"", "/example/doc", "other"},
+		{"/couchdb", "/couchdb/example", "db_info"},
+		{"/couchdb/", "/couchdb/_node/_local/_stats", "_stats"},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := normalizeEndpoint(test.basePath, u); actual != test.expected {
+			t.Errorf("expected endpoint %s for %s, got %s", test.expected, test.uri, actual)
+		}
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/couchdb/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = w.Write([]byte(`{"db_name":"example"}`))
+	}))
+	defer server.Close()
+
+	metrics := &RequestMetrics{
+		DurationSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration"}, []string{"endpoint", "method", "code"}),
+		ResponseBytes:   prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "size"}, []string{"endpoint", "method", "code"}),
+		Errors:          prometheus.NewCounterVec(prometheus.CounterOpts{Name: "errors"}, []string{"endpoint", "error"}),
+	}
+	client := NewCouchdbClient(server.URL+"/couchdb", false, BasicAuth{}, false)
+	client.transport.metrics = metrics
+
+	_, err := client.Request("GET", client.BaseUri+"/example", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Request("GET", client.BaseUri+"/missing", nil)
+	if err == nil {
+		t.Fatal("expected error for missing database")
+	}
+	if !errors.Is(err, couchmon.ErrNotFound) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	var errorCount dto.Metric
+	err = metrics.Errors.WithLabelValues("db_info", "404").Write(&errorCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errorCount.GetCounter().GetValue() != 1 {
+		t.Errorf("expected a single error of the missing database, got %v", errorCount.GetCounter().GetValue())
+	}
+
+	for _, code := range []string{"200", "404"} {
+		var m dto.Metric
+		err = metrics.ResponseBytes.WithLabelValues("db_info", "GET", code).(prometheus.Histogram).Write(&m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.GetHistogram().GetSampleCount() != 1 || m.GetHistogram().GetSampleSum() != 21 {
+			t.Errorf("expected a single response of 21 bytes with code %s, got %d with %f bytes", code, m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum())
+		}
+		err = metrics.DurationSeconds.WithLabelValues("db_info", "GET", code).(prometheus.Histogram).Write(&m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.GetHistogram().GetSampleCount() != 1 {
+			t.Errorf("expected a single request duration with code %s, got %d", code, m.GetHistogram().GetSampleCount())
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package lib
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// databaseSampler rotates through the observed databases when scraping all of them
+// would exceed the request budget of a single scrape. The last values of databases
+// which haven't been sampled in the current scrape are kept and reported with their age.
+type databaseSampler struct {
+	maxRequests uint
+	mutex       sync.Mutex
+	samples     map[string]databaseSample
+}
+
+type databaseSample struct {
+	stats     DatabaseStats
+	timestamp time.Time
+}
+
+// newDatabaseSampler for a request budget, maxRequests == 0 means unlimited
+func newDatabaseSampler(maxRequests uint) *databaseSampler {
+	return &databaseSampler{
+		maxRequests: maxRequests,
+		samples:     make(map[string]databaseSample),
+	}
+}
+
+func (s *databaseSampler) enabled() bool {
+	return s != nil && s.maxRequests > 0
+}
+
+// cost estimates the number of requests needed to scrape a database,
+// based on the number of views known from its last sample.
+func (s *databaseSampler) cost(dbName string, collectViews bool) uint {
+	cost := uint(1)
+	if collectViews {
+		cost++
+		for _, views := range s.samples[dbName].stats.Views {
+			cost += uint(len(views))
+		}
+	}
+	return cost
+}
+
+// next returns the databases to be scraped next, least recently sampled first,
+// within the request budget. At least one database is returned, so that
+// the rotation always makes progress.
+func (s *databaseSampler) next(databases []string, collectViews bool) []string {
+	if !s.enabled() {
+		return databases
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	candidates := append([]string{}, databases...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return s.samples[candidates[i]].timestamp.Before(s.samples[candidates[j]].timestamp)
+	})
+
+	var requests uint
+	sampled := make([]string, 0)
+	for _, dbName := range candidates {
+		cost := s.cost(dbName, collectViews)
+		if len(sampled) > 0 && requests+cost > s.maxRequests {
+			break
+		}
+		requests += cost
+		sampled = append(sampled, dbName)
+	}
+	return sampled
+}
+
+// merge stores the freshly scraped stats and returns the latest known stats of the given databases
+func (s *databaseSampler) merge(databases []string, fresh DatabaseStatsByDbName, now time.Time) DatabaseStatsByDbName {
+	if !s.enabled() {
+		return fresh
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for dbName, stats := range fresh {
+		s.samples[dbName] = databaseSample{stats: stats, timestamp: now}
+	}
+
+	merged := make(DatabaseStatsByDbName, len(databases))
+	for _, dbName := range databases {
+		if sample, ok := s.samples[dbName]; ok {
+			merged[dbName] = sample.stats
+		}
+	}
+	return merged
+}
+
+// prune drops the samples of databases which aren't observed anymore
+func (s *databaseSampler) prune(databases []string) {
+	if !s.enabled() {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	observed := make(map[string]struct{}, len(databases))
+	for _, dbName := range databases {
+		observed[dbName] = struct{}{}
+	}
+	for dbName := range s.samples {
+		if _, ok := observed[dbName]; !ok {
+			delete(s.samples, dbName)
+		}
+	}
+}
+
+// ages returns the age of the latest sample of every sampled database
+func (s *databaseSampler) ages(now time.Time) map[string]time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ages := make(map[string]time.Duration, len(s.samples))
+	for dbName, sample := range s.samples {
+		ages[dbName] = now.Sub(sample.timestamp)
+	}
+	return ages
+}
@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gesellix/couchdb-prometheus-exporter/v30/couchmon"
+)
+
+func TestDatabaseSamplerRotatesWithinBudget(t *testing.T) {
+	sampler := newDatabaseSampler(2)
+	databases := []string{"a", "b", "c", "d", "e"}
+	start := time.Now()
+
+	seen := make(map[string]int)
+	for i := 0; i < 3; i++ {
+		sampled := sampler.next(databases, false)
+		if len(sampled) > 2 {
+			t.Errorf("expected at most 2 databases per scrape, got %v", sampled)
+		}
+		fresh := make(DatabaseStatsByDbName)
+		for _, dbName := range sampled {
+			seen[dbName]++
+			fresh[dbName] = DatabaseStats{DatabaseInfo: couchmon.DatabaseInfo{DocCount: float64(i)}}
+		}
+		sampler.merge(databases, fresh, start.Add(time.Duration(i)*time.Second))
+	}
+
+	for _, dbName := range databases {
+		if seen[dbName] == 0 {
+			t.Errorf("expected database '%s' to be sampled within three scrapes", dbName)
+		}
+	}
+
+	now := start.Add(10 * time.Second)
+	ages := sampler.ages(now)
+	if ages["b"] != 10*time.Second {
+		t.Errorf("expected the least recent sample to be 10s old, got %v", ages["b"])
+	}
+	if ages["e"] != 8*time.Second {
+		t.Errorf("expected the latest sample to be 8s old, got %v", ages["e"])
+	}
+}
+
+func TestDatabaseSamplerKeepsLastValues(t *testing.T) {
+	sampler := newDatabaseSampler(1)
+	databases := []string{"a", "b"}
+	now := time.Now()
+
+	sampler.merge(databases, DatabaseStatsByDbName{"a": {DatabaseInfo: couchmon.DatabaseInfo{DocCount: 1}}}, now)
+	merged := sampler.merge(databases, DatabaseStatsByDbName{"b": {DatabaseInfo: couchmon.DatabaseInfo{DocCount: 2}}}, now.Add(time.Second))
+
+	expected := DatabaseStatsByDbName{"a": {DatabaseInfo: couchmon.DatabaseInfo{DocCount: 1}}, "b": {DatabaseInfo: couchmon.DatabaseInfo{DocCount: 2}}}
+	if !reflect.DeepEqual(expected, merged) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+
+	sampler.prune([]string{"b"})
+	if _, ok := sampler.ages(now)["a"]; ok {
+		t.Errorf("expected samples of databases which aren't observed anymore to be dropped")
+	}
+}
+
+func TestDatabaseSamplerCountsViews(t *testing.T) {
+	sampler := newDatabaseSampler(5)
+	databases := []string{"a", "b"}
+	sampler.merge(databases, DatabaseStatsByDbName{
+		"a": {Views: ViewStatsByDesignDocName{"_design/views": ViewStats{"by_id": "1", "by_name": "1"}}},
+	}, time.Now())
+
+	// "b" has never been sampled (cost 2), "a" needs 1 + 1 + 2 views
+	sampled := sampler.next(databases, true)
+	if !reflect.DeepEqual([]string{"b"}, sampled) {
+		t.Errorf("expected the view requests to count against the budget, got %v", sampled)
+	}
+}
+
+func TestDisabledDatabaseSampler(t *testing.T) {
+	sampler := newDatabaseSampler(0)
+	databases := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(databases, sampler.next(databases, true)) {
+		t.Errorf("expected all databases to be scraped without a budget")
+	}
+}
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// DatabaseShard selects the subset of databases observed by this exporter instance,
+// so that several instances can share the per-database scraping of a large cluster.
+// A zero Count disables sharding.
+type DatabaseShard struct {
+	Index uint
+	Count uint
+	// NodeMetricsShard is the index of the shard emitting node-level metrics,
+	// negative values let every shard emit them.
+	NodeMetricsShard int
+}
+
+// ParseDatabaseShard parses a shard definition like "1/4", an empty definition disables sharding
+func ParseDatabaseShard(definition string) (DatabaseShard, error) {
+	definition = strings.TrimSpace(definition)
+	if definition == "" {
+		return DatabaseShard{}, nil
+	}
+	parts := strings.Split(definition, "/")
+	if len(parts) != 2 {
+		return DatabaseShard{}, fmt.Errorf("invalid database shard '%s', expected format 'i/n'", definition)
+	}
+	index, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 32)
+	if err != nil {
+		return DatabaseShard{}, fmt.Errorf("invalid database shard index in '%s': %v", definition, err)
+	}
+	count, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 32)
+	if err != nil {
+		return DatabaseShard{}, fmt.Errorf("invalid database shard count in '%s': %v", definition, err)
+	}
+	if count == 0 || index >= count {
+		return DatabaseShard{}, fmt.Errorf("invalid database shard '%s', expected 0 <= i < n", definition)
+	}
+	return DatabaseShard{Index: uint(index), Count: uint(count)}, nil
+}
+
+// Contains returns true if the database name hashes into this shard
+func (s DatabaseShard) Contains(dbName string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(dbName))
+	return uint(h.Sum32())%s.Count == s.Index
+}
+
+// Filter returns the subset of databases hashing into this shard
+func (s DatabaseShard) Filter(databases []string) []string {
+	if s.Count <= 1 {
+		return databases
+	}
+	filtered := make([]string, 0, len(databases)/int(s.Count)+1)
+	for _, dbName := range databases {
+		if s.Contains(dbName) {
+			filtered = append(filtered, dbName)
+		}
+	}
+	return filtered
+}
+
+// Validate returns an error if the node-level metrics are assigned to a shard which doesn't exist,
+// since no instance would emit them
+func (s DatabaseShard) Validate() error {
+	if s.Count > 1 && s.NodeMetricsShard >= int(s.Count) {
+		return fmt.Errorf("invalid node metrics shard %d, expected -1 or 0 <= i < %d", s.NodeMetricsShard, s.Count)
+	}
+	return nil
+}
+
+// EmitsNodeMetrics returns true if this shard is responsible for node-level metrics
+func (s DatabaseShard) EmitsNodeMetrics() bool {
+	return s.Count <= 1 || s.NodeMetricsShard < 0 || uint(s.NodeMetricsShard) == s.Index
+}
+
+func (s DatabaseShard) String() string {
+	if s.Count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
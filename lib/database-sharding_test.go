@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseDatabaseShard(t *testing.T) {
+	shard, err := ParseDatabaseShard(" 1/4 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shard.Index != 1 || shard.Count != 4 {
+		t.Errorf("expected shard 1/4, got %s", shard)
+	}
+
+	disabled, err := ParseDatabaseShard("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disabled.Count != 0 || !disabled.Contains("any") || !disabled.EmitsNodeMetrics() {
+		t.Errorf("expected an empty definition to disable sharding")
+	}
+
+	for _, invalid := range []string{"1", "4/4", "1/0", "a/2", "1/b", "1/2/3"} {
+		if _, err := ParseDatabaseShard(invalid); err == nil {
+			t.Errorf("expected an error for '%s'", invalid)
+		}
+	}
+}
+
+func TestDatabaseShardPartitionsDatabases(t *testing.T) {
+	databases := make([]string, 1000)
+	for i := range databases {
+		databases[i] = fmt.Sprintf("db-%d", i)
+	}
+
+	count := uint(4)
+	seen := make(map[string]int)
+	for index := uint(0); index < count; index++ {
+		shard := DatabaseShard{Index: index, Count: count}
+		filtered := shard.Filter(databases)
+		if len(filtered) == 0 {
+			t.Errorf("expected shard %s to observe some databases", shard)
+		}
+		for _, dbName := range filtered {
+			seen[dbName]++
+		}
+	}
+
+	for _, dbName := range databases {
+		if seen[dbName] != 1 {
+			t.Errorf("expected database '%s' to be observed by exactly one shard, got %d", dbName, seen[dbName])
+		}
+	}
+}
+
+func TestDatabaseShardEmitsNodeMetrics(t *testing.T) {
+	if !(DatabaseShard{Index: 0, Count: 3}).EmitsNodeMetrics() {
+		t.Errorf("expected shard 0 to emit node metrics by default")
+	}
+	if (DatabaseShard{Index: 1, Count: 3}).EmitsNodeMetrics() {
+		t.Errorf("expected shard 1 not to emit node metrics by default")
+	}
+	if !(DatabaseShard{Index: 2, Count: 3, NodeMetricsShard: 2}).EmitsNodeMetrics() {
+		t.Errorf("expected the configured shard to emit node metrics")
+	}
+	if !(DatabaseShard{Index: 1, Count: 3, NodeMetricsShard: -1}).EmitsNodeMetrics() {
+		t.Errorf("expected every shard to emit node metrics")
+	}
+}
+
+func TestDatabaseShardValidate(t *testing.T) {
+	for _, valid := range []DatabaseShard{
+		{},
+		{Index: 0, Count: 3},
+		{Index: 1, Count: 3, NodeMetricsShard: 2},
+		{Index: 1, Count: 3, NodeMetricsShard: -1},
+	} {
+		if err := valid.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", valid, err)
+		}
+	}
+	for _, invalid := range []DatabaseShard{
+		{Index: 0, Count: 3, NodeMetricsShard: 3},
+		{Index: 0, Count: 3, NodeMetricsShard: 5},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
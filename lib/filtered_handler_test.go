@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"log/slog"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCollectorGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		collect  []string
+		exclude  []string
+		expected []CollectorGroup
+	}{
+		{"default", nil, nil, []CollectorGroup{CollectorGroupStandard}},
+		{"unknown groups fall back to default", []string{"unknown"}, nil, []CollectorGroup{CollectorGroupStandard}},
+		{"collect", []string{"Databases", " views "}, nil, []CollectorGroup{CollectorGroupDatabases, CollectorGroupViews}},
+		{"collect and exclude", []string{"standard", "databases"}, []string{"databases"}, []CollectorGroup{CollectorGroupStandard}},
+		{"exclude from the default", nil, []string{"views", "scheduler"}, []CollectorGroup{CollectorGroupStandard}},
+		{"exclude the default", nil, []string{"standard"}, []CollectorGroup{}},
+		{"exclude everything", []string{"standard"}, []string{"standard"}, []CollectorGroup{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected := make(map[CollectorGroup]struct{})
+			for _, group := range test.expected {
+				expected[group] = struct{}{}
+			}
+			actual := parseCollectorGroups(test.collect, test.exclude, slog.Default())
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected %v, got %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseDatabaseSelection(t *testing.T) {
+	query, _ := url.ParseQuery("db[]=example&db[]=other&db_regex=^shard-[0-4]")
+	selection, err := parseDatabaseSelection(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual := selection.Filter([]string{"example", "another-example", "shard-1", "shard-7", "other"})
+	expected := []string{"example", "shard-1", "other"}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	reordered, _ := url.ParseQuery("db_regex=^shard-[0-4]&db[]=other&db[]=example")
+	reorderedSelection, _ := parseDatabaseSelection(reordered)
+	if selection.String() != reorderedSelection.String() {
+		t.Errorf("expected equal keys for equal selections, got '%s' and '%s'", selection.String(), reorderedSelection.String())
+	}
+
+	empty, _ := parseDatabaseSelection(url.Values{})
+	if !empty.IsEmpty() || len(empty.Filter([]string{"example"})) != 1 {
+		t.Errorf("expected an empty selection to match every database")
+	}
+
+	invalid, _ := url.ParseQuery("db_regex=[")
+	if _, err := parseDatabaseSelection(invalid); err == nil {
+		t.Errorf("expected an error for an invalid db_regex")
+	}
+}
+
+var databasesGroup = map[CollectorGroup]struct{}{CollectorGroupDatabases: {}}
+
+func TestFilteredScrapingWithoutCache(t *testing.T) {
+	server := newCouchdbServer(map[string]string{
+		"/":         `{"couchdb":"Welcome","version":"3.3.2"}`,
+		"/_all_dbs": `["example"]`,
+	})
+	defer server.Close()
+
+	e := NewFilteredExporter(server.URL, false, BasicAuth{}, CollectorConfig{
+		Databases:  []string{AllDbs},
+		Collectors: onlyCollectors("databases"),
+	}, false)
+	if _, err := e.scrapeAndGather(databasesGroup, DatabaseSelection{Names: []string{"example"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.cache) != 0 {
+		t.Errorf("expected no cached results with caching disabled, got %d", len(e.cache))
+	}
+}
+
+func TestFilteredScrapingCachePrunesExpiredSelections(t *testing.T) {
+	server := newCouchdbServer(map[string]string{
+		"/":         `{"couchdb":"Welcome","version":"3.3.2"}`,
+		"/_all_dbs": `["example","other"]`,
+		"/example":  `{"db_name":"example"}`,
+		"/other":    `{"db_name":"other"}`,
+	})
+	defer server.Close()
+
+	e := NewFilteredExporter(server.URL, false, BasicAuth{}, CollectorConfig{
+		Databases:        []string{AllDbs},
+		FilteredCacheAge: time.Minute,
+		Collectors:       onlyCollectors("databases"),
+	}, false)
+	expired := DatabaseSelection{Names: []string{"example"}}
+	if _, err := e.scrapeAndGather(databasesGroup, expired); err != nil {
+		t.Fatal(err)
+	}
+	for key, cached := range e.cache {
+		cached.timestamp = cached.timestamp.Add(-time.Hour)
+		e.cache[key] = cached
+	}
+
+	if _, err := e.scrapeAndGather(databasesGroup, DatabaseSelection{Names: []string{"other"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.cache[keyFor(CollectorGroupDatabases, expired)]; ok {
+		t.Errorf("expected the expired selection to be pruned")
+	}
+	if len(e.cache) != 1 {
+		t.Errorf("expected only the result of the latest scrape, got %d entries", len(e.cache))
+	}
+}
+
+func TestFilteredScrapingRunsOnlyTheRequestedGroups(t *testing.T) {
+	// the node stats fail without _membership, so that scrapes of the standard group fail
+	server := newCouchdbServer(map[string]string{
+		"/":         `{"couchdb":"Welcome","version":"3.3.2"}`,
+		"/_all_dbs": `["example"]`,
+		"/example":  `{"db_name":"example","doc_count":1}`,
+	})
+	defer server.Close()
+
+	e := NewFilteredExporter(server.URL, false, BasicAuth{}, CollectorConfig{
+		Databases:        []string{AllDbs},
+		FilteredCacheAge: time.Minute,
+	}, false)
+	gathered, err := e.scrapeAndGather(databasesGroup, DatabaseSelection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gathered[CollectorGroupStandard]; ok || len(gathered) != 1 {
+		t.Errorf("expected only the databases group to be gathered, got %v", gathered)
+	}
+	if _, ok := e.cache[keyFor(CollectorGroupDatabases, DatabaseSelection{})]; !ok {
+		t.Errorf("expected the databases group to be scraped without the node stats and cached")
+	}
+
+	standardGroup := map[CollectorGroup]struct{}{CollectorGroupStandard: {}}
+	if _, err := e.scrapeAndGather(standardGroup, DatabaseSelection{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.cache[keyFor(CollectorGroupStandard, DatabaseSelection{})]; ok {
+		t.Errorf("expected the result of the failed scrape not to be cached")
+	}
+
+	if flightKey(databasesGroup, DatabaseSelection{}) == flightKey(standardGroup, DatabaseSelection{}) {
+		t.Errorf("expected different flights for different groups")
+	}
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// histogramDescs describe a CouchDB histogram as a summary with the quantiles of its percentiles,
+// and its other statistics as separate gauges
+type histogramDescs struct {
+	summary           *prometheus.Desc
+	min               *prometheus.Desc
+	max               *prometheus.Desc
+	arithmeticMean    *prometheus.Desc
+	geometricMean     *prometheus.Desc
+	harmonicMean      *prometheus.Desc
+	median            *prometheus.Desc
+	standardDeviation *prometheus.Desc
+	variance          *prometheus.Desc
+	skewness          *prometheus.Desc
+	kurtosis          *prometheus.Desc
+
+	// scale converts the values of CouchDB into the unit of the metrics, e.g. from milliseconds to seconds
+	scale float64
+}
+
+// newHistogramDescs creates the descriptions of a histogram with newDesc, which appends the suffix to the name of the histogram.
+// The unit, if any, is appended to the names of the summary and the statistics measured in the same unit.
+func newHistogramDescs(newDesc func(suffix string, help string) *prometheus.Desc, unit string, scale float64, help string) *histogramDescs {
+	unitSuffix := ""
+	if unit != "" {
+		unitSuffix = "_" + unit
+	}
+	return &histogramDescs{
+		summary:           newDesc(unitSuffix, help),
+		min:               newDesc("_min"+unitSuffix, help+" - min"),
+		max:               newDesc("_max"+unitSuffix, help+" - max"),
+		arithmeticMean:    newDesc("_arithmetic_mean"+unitSuffix, help+" - arithmetic mean"),
+		geometricMean:     newDesc("_geometric_mean"+unitSuffix, help+" - geometric mean"),
+		harmonicMean:      newDesc("_harmonic_mean"+unitSuffix, help+" - harmonic mean"),
+		median:            newDesc("_median"+unitSuffix, help+" - median"),
+		standardDeviation: newDesc("_standard_deviation"+unitSuffix, help+" - standard deviation"),
+		variance:          newDesc("_variance", help+" - variance"),
+		skewness:          newDesc("_skewness", help+" - skewness"),
+		kurtosis:          newDesc("_kurtosis", help+" - kurtosis"),
+		scale:             scale,
+	}
+}
+
+// newHistogramDescs creates the descriptions of a histogram in the collector group, see newHistogramDescs
+func (d *metricDescs) newHistogramDescs(group CollectorGroup, subsystem string, name string, unit string, scale float64, help string, variableLabels ...string) *histogramDescs {
+	return newHistogramDescs(func(suffix string, help string) *prometheus.Desc {
+		return d.newDesc(group, subsystem, name+suffix, help, variableLabels...)
+	}, unit, scale, help)
+}
+
+// setHistogram sets the summary of a histogram, with the number of samples as count and the sum of the samples
+// derived from their arithmetic mean, and the gauges of its other statistics
+func (b *snapshotBuilder) setHistogram(h *histogramDescs, histogram HistogramValue, labelValues ...string) {
+	quantiles := make(map[float64]float64, len(histogram.Percentile))
+	for _, percentile := range histogram.Percentile {
+		if len(percentile) == 2 {
+			quantiles[percentileToQuantile(percentile[0])] = percentile[1] * h.scale
+		}
+	}
+	key := sampleKey{h.summary, strings.Join(labelValues, "\xff")}
+	b.metrics[key] = prometheus.MustNewConstSummary(h.summary, uint64(histogram.N), histogram.ArithmeticMean*histogram.N*h.scale, quantiles, labelValues...)
+
+	b.set(h.min, histogram.Min*h.scale, labelValues...)
+	b.set(h.max, histogram.Max*h.scale, labelValues...)
+	b.set(h.arithmeticMean, histogram.ArithmeticMean*h.scale, labelValues...)
+	b.set(h.geometricMean, histogram.GeometricMean*h.scale, labelValues...)
+	b.set(h.harmonicMean, histogram.HarmonicMean*h.scale, labelValues...)
+	b.set(h.median, histogram.Median*h.scale, labelValues...)
+	b.set(h.standardDeviation, histogram.StandardDeviation*h.scale, labelValues...)
+	b.set(h.variance, histogram.Variance*h.scale*h.scale, labelValues...)
+	b.set(h.skewness, histogram.Skewness, labelValues...)
+	b.set(h.kurtosis, histogram.Kurtosis, labelValues...)
+}
+
+// percentileToQuantile maps CouchDB's percentiles like 50, 99 or 999 (99.9) to quantiles like 0.5, 0.99 or 0.999
+func percentileToQuantile(percentile float64) float64 {
+	quantile := percentile / 100
+	for quantile > 1 {
+		quantile /= 10
+	}
+	return quantile
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSetHistogram(t *testing.T) {
+	descs := newMetricDescs(namespace, nil, MetricNamingLegacy)
+	h := descs.newHistogramDescs(CollectorGroupStandard, "httpd", "request_time", "seconds", 0.001, "length of a request", "node_name")
+	b := newSnapshotBuilder(descs)
+	b.setHistogram(h, HistogramValue{
+		N:              4,
+		ArithmeticMean: 250,
+		Min:            100,
+		Variance:       10000,
+		Kurtosis:       2,
+		Percentile:     [][]float64{{50, 200}, {99, 800}, {999, 900}},
+	}, "node1@a")
+	snapshot := b.build(1, time.Now())
+
+	values := make(map[string]*dto.Metric)
+	for _, metric := range snapshot.metrics {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		values[metric.Desc().String()] = &m
+	}
+
+	summary := values[h.summary.String()].GetSummary()
+	if summary.GetSampleCount() != 4 || !almostEqual(summary.GetSampleSum(), 1) {
+		t.Errorf("expected 4 samples with a sum of 1s, got %d and %v", summary.GetSampleCount(), summary.GetSampleSum())
+	}
+	expectedQuantiles := map[float64]float64{0.5: 0.2, 0.99: 0.8, 0.999: 0.9}
+	for _, quantile := range summary.GetQuantile() {
+		if expected, ok := expectedQuantiles[quantile.GetQuantile()]; !ok || !almostEqual(quantile.GetValue(), expected) {
+			t.Errorf("unexpected quantile %v: %v", quantile.GetQuantile(), quantile.GetValue())
+		}
+	}
+	if len(summary.GetQuantile()) != len(expectedQuantiles) {
+		t.Errorf("expected %d quantiles, got %d", len(expectedQuantiles), len(summary.GetQuantile()))
+	}
+
+	gauges := []struct {
+		value    *dto.Metric
+		expected float64
+	}{
+		{values[h.min.String()], 0.1},
+		{values[h.variance.String()], 0.01},
+		{values[h.kurtosis.String()], 2},
+	}
+	for _, gauge := range gauges {
+		if !almostEqual(gauge.value.GetGauge().GetValue(), gauge.expected) {
+			t.Errorf("expected %v, got %v", gauge.expected, gauge.value.GetGauge().GetValue())
+		}
+	}
+}
+
+func TestPercentileToQuantile(t *testing.T) {
+	for percentile, expected := range map[float64]float64{50: 0.5, 75: 0.75, 99: 0.99, 100: 1, 999: 0.999} {
+		if actual := percentileToQuantile(percentile); !almostEqual(actual, expected) {
+			t.Errorf("expected quantile %v for percentile %v, got %v", expected, percentile, actual)
+		}
+	}
+}
+
+func almostEqual(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
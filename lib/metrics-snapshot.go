@@ -0,0 +1,193 @@
+package lib
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsSnapshot is the immutable result of a scrape. Asynchronous scrapes swap in a new snapshot,
+// which is served until the next successful scrape.
+type metricsSnapshot struct {
+	metrics []prometheus.Metric
+	// scrapeMetrics are the exporter's own metrics of the latest scrape, like its duration.
+	// They are served even when the scrape failed, or when the metrics exceed the max age.
+	scrapeMetrics []prometheus.Metric
+	timestamp     time.Time
+	up            float64
+}
+
+// inGroups returns the metrics of the snapshot belonging to the collector groups
+func (s *metricsSnapshot) inGroups(descs *metricDescs, groups ...CollectorGroup) []prometheus.Metric {
+	return metricsInGroups(descs, s.metrics, groups...)
+}
+
+// scrapeMetricsInGroups returns the metrics of the latest scrape belonging to the collector groups
+func (s *metricsSnapshot) scrapeMetricsInGroups(descs *metricDescs, groups ...CollectorGroup) []prometheus.Metric {
+	return metricsInGroups(descs, s.scrapeMetrics, groups...)
+}
+
+func metricsInGroups(descs *metricDescs, all []prometheus.Metric, groups ...CollectorGroup) []prometheus.Metric {
+	var metrics []prometheus.Metric
+	for _, metric := range all {
+		for _, group := range groups {
+			if descs.groupOf(metric.Desc()) == group {
+				metrics = append(metrics, metric)
+			}
+		}
+	}
+	return metrics
+}
+
+type sampleKey struct {
+	desc        *prometheus.Desc
+	labelValues string
+}
+
+// snapshotBuilder collects the values of a single scrape as const metrics.
+// Setting the same labels of a metric again replaces the previous value.
+type snapshotBuilder struct {
+	descs   *metricDescs
+	metrics map[sampleKey]prometheus.Metric
+}
+
+func newSnapshotBuilder(descs *metricDescs) *snapshotBuilder {
+	return &snapshotBuilder{descs: descs, metrics: make(map[sampleKey]prometheus.Metric)}
+}
+
+// set sets the value of a gauge, or of a CouchDB counter as configured by the metric naming
+func (b *snapshotBuilder) set(desc *prometheus.Desc, value float64, labelValues ...string) {
+	isCounter, counter := b.descs.counterOf(desc)
+	if isCounter {
+		b.setValue(desc, prometheus.CounterValue, value, labelValues...)
+	} else {
+		b.setValue(desc, prometheus.GaugeValue, value, labelValues...)
+	}
+	if counter != nil {
+		b.setValue(counter, prometheus.CounterValue, value, labelValues...)
+	}
+}
+
+// setCounter sets the value of a counter, for values which only grow until the node restarts
+func (b *snapshotBuilder) setCounter(desc *prometheus.Desc, value float64, labelValues ...string) {
+	b.setValue(desc, prometheus.CounterValue, value, labelValues...)
+}
+
+func (b *snapshotBuilder) setValue(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labelValues ...string) {
+	key := sampleKey{desc, strings.Join(labelValues, "\xff")}
+	b.metrics[key] = prometheus.MustNewConstMetric(desc, valueType, value, labelValues...)
+}
+
+// take removes the metrics of the descriptions from the builder and returns them
+func (b *snapshotBuilder) take(descs ...*prometheus.Desc) []prometheus.Metric {
+	var metrics []prometheus.Metric
+	for key, metric := range b.metrics {
+		for _, desc := range descs {
+			if key.desc == desc {
+				metrics = append(metrics, metric)
+				delete(b.metrics, key)
+			}
+		}
+	}
+	return metrics
+}
+
+func (b *snapshotBuilder) build(up float64, timestamp time.Time) *metricsSnapshot {
+	metrics := make([]prometheus.Metric, 0, len(b.metrics))
+	for _, metric := range b.metrics {
+		metrics = append(metrics, metric)
+	}
+	return &metricsSnapshot{
+		metrics:   metrics,
+		timestamp: timestamp,
+		up:        up,
+	}
+}
+
+// recordScrapeResult updates the scrape meta-metrics and swaps in the snapshot of the scrape.
+// When scraping asynchronously, failed scrapes keep the metrics of the last successful one,
+// along with the scrape metrics of the failed scrape.
+func (e *Exporter) recordScrapeResult(b *snapshotBuilder, err error) *metricsSnapshot {
+	now := time.Now()
+	scrapeMetrics := b.take(e.scrapeDescs()...)
+	if err == nil {
+		e.lastSuccess.Set(float64(now.UnixNano()) / 1e9)
+		snapshot := b.build(1, now)
+		snapshot.scrapeMetrics = scrapeMetrics
+		e.snapshot.Store(snapshot)
+		return snapshot
+	}
+
+	e.scrapeFailures.Inc()
+	snapshot := &metricsSnapshot{scrapeMetrics: scrapeMetrics, timestamp: now, up: 0}
+	if previous := e.snapshot.Load(); previous != nil && e.collectorConfig.ScrapeInterval != 0 {
+		snapshot.metrics = previous.metrics
+		snapshot.timestamp = previous.timestamp
+	}
+	e.snapshot.Store(snapshot)
+	return snapshot
+}
+
+// groupCollector delivers the metrics of the collector groups from a snapshot,
+// or from the latest snapshot if none is given
+func (e *Exporter) groupCollector(snapshot *metricsSnapshot, groups ...CollectorGroup) prometheus.Collector {
+	return &snapshotCollector{
+		exporter: e,
+		snapshot: snapshot,
+		groups:   groups,
+	}
+}
+
+type snapshotCollector struct {
+	exporter *Exporter
+	snapshot *metricsSnapshot
+	groups   []CollectorGroup
+}
+
+func (c *snapshotCollector) withStandardGroup() bool {
+	for _, group := range c.groups {
+		if group == CollectorGroupStandard {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.exporter.inGroups(c.groups...) {
+		ch <- desc
+	}
+	if c.withStandardGroup() {
+		for _, collector := range c.exporter.liveCollectors() {
+			collector.Describe(ch)
+		}
+	}
+}
+
+// Collect delivers the snapshot, unless it exceeds the configured max age
+func (c *snapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	snapshot := c.snapshot
+	if snapshot == nil {
+		snapshot = c.exporter.snapshot.Load()
+	}
+	up := 0.0
+	if snapshot != nil {
+		up = snapshot.up
+		for _, metric := range snapshot.scrapeMetricsInGroups(c.exporter.metricDescs, c.groups...) {
+			ch <- metric
+		}
+		maxAge := c.exporter.collectorConfig.MaxSnapshotAge
+		if maxAge == 0 || time.Since(snapshot.timestamp) <= maxAge {
+			for _, metric := range snapshot.inGroups(c.exporter.metricDescs, c.groups...) {
+				ch <- metric
+			}
+		}
+	}
+	if c.withStandardGroup() {
+		ch <- prometheus.MustNewConstMetric(c.exporter.up, prometheus.GaugeValue, up)
+		for _, collector := range c.exporter.liveCollectors() {
+			collector.Collect(ch)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package lib
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSnapshotBuilder(t *testing.T) {
+	descs := newMetricDescs(namespace, nil, MetricNamingLegacy)
+	databases := newDatabasesCollector(descs, slog.Default()).(*databasesCollector)
+	scheduler := newSchedulerCollector(descs, slog.Default()).(*schedulerCollector)
+	b := newSnapshotBuilder(descs)
+	b.set(databases.docCount, 1, "example")
+	b.set(databases.docCount, 2, "example")
+	b.set(databases.docCount, 3, "other")
+	b.set(scheduler.schedulerJobs, 1, "node", "job", "db", "doc", "source", "target")
+
+	snapshot := b.build(1, time.Now())
+	if len(snapshot.metrics) != 3 {
+		t.Fatalf("expected 3 metrics, got %d", len(snapshot.metrics))
+	}
+
+	databaseMetrics := snapshot.inGroups(descs, CollectorGroupDatabases)
+	if len(databaseMetrics) != 2 {
+		t.Fatalf("expected 2 database metrics, got %d", len(databaseMetrics))
+	}
+	for _, metric := range databaseMetrics {
+		var m dto.Metric
+		err := metric.Write(&m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.GetLabel()[0].GetValue() == "example" && m.GetGauge().GetValue() != 2 {
+			t.Errorf("expected the latest value 2, got %f", m.GetGauge().GetValue())
+		}
+	}
+
+	if len(snapshot.inGroups(descs, CollectorGroupStandard, CollectorGroupViews)) != 0 {
+		t.Error("expected no standard or views metrics")
+	}
+}
+
+func TestSnapshotCollectorMaxAge(t *testing.T) {
+	e := newExporter(newOptions(WithCollectorConfig(CollectorConfig{MaxSnapshotAge: time.Minute})))
+	b := newSnapshotBuilder(e.metricDescs)
+	b.set(e.collectors["databases"].(*databasesCollector).docCount, 1, "example")
+
+	fresh := b.build(1, time.Now())
+	if count := collectCount(e.groupCollector(fresh, CollectorGroupDatabases)); count != 1 {
+		t.Errorf("expected the fresh snapshot to be served, got %d metrics", count)
+	}
+
+	stale := b.build(1, time.Now().Add(-time.Hour))
+	if count := collectCount(e.groupCollector(stale, CollectorGroupDatabases)); count != 0 {
+		t.Errorf("expected the stale snapshot to be dropped, got %d metrics", count)
+	}
+}
+
+func TestFailedScrapeKeepsScrapeMetrics(t *testing.T) {
+	responses := map[string]string{
+		"/":         `{"couchdb":"Welcome","version":"3.3.2"}`,
+		"/_all_dbs": `["example"]`,
+		"/example":  `{"db_name":"example","doc_count":1}`,
+	}
+	server := newCouchdbServer(responses)
+	defer server.Close()
+
+	e := newExporter(newOptions(WithURI(server.URL), WithCollectorConfig(CollectorConfig{
+		ScrapeInterval: time.Minute,
+		MaxSnapshotAge: time.Minute,
+		Databases:      []string{AllDbs},
+		Collectors:     onlyCollectors("databases"),
+	})))
+	if _, err := e.scrape(); err != nil {
+		t.Fatal(err)
+	}
+
+	responses["/"] = `{"error":"internal_server_error","reason":"failure"}`
+	snapshot, err := e.scrape()
+	if err == nil {
+		t.Fatal("expected the scrape to fail")
+	}
+	if len(snapshotValues(t, &metricsSnapshot{metrics: snapshot.scrapeMetrics}, e.scrapeDuration)) != 1 {
+		t.Errorf("expected the duration of the failed scrape")
+	}
+	if _, ok := snapshotValues(t, &metricsSnapshot{metrics: snapshot.scrapeMetrics}, e.scrapePhaseDuration)["phase=version"]; !ok {
+		t.Errorf("expected the phase durations of the failed scrape")
+	}
+	if len(snapshot.inGroups(e.metricDescs, CollectorGroupDatabases)) == 0 {
+		t.Errorf("expected the metrics of the last successful scrape")
+	}
+
+	snapshot.timestamp = time.Now().Add(-time.Hour)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e.groupCollector(snapshot, CollectorGroupStandard))
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := false
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() == "couchdb_exporter_scrape_duration_seconds" {
+			served = true
+		}
+	}
+	if !served {
+		t.Errorf("expected the scrape metrics to be served beyond the max age")
+	}
+}
+
+func collectCount(collector prometheus.Collector) int {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	count := 0
+	for range ch {
+		count++
+	}
+	return count
+}
+
+func TestMetricNaming(t *testing.T) {
+	tests := []struct {
+		naming   MetricNaming
+		expected map[string]dto.MetricType
+		missing  []string
+	}{
+		{
+			naming:   MetricNamingLegacy,
+			expected: map[string]dto.MetricType{"couchdb_httpd_requests": dto.MetricType_GAUGE, "couchdb_httpd_open_databases": dto.MetricType_GAUGE},
+			missing:  []string{"couchdb_httpd_requests_total"},
+		},
+		{
+			naming:   MetricNamingPrometheus,
+			expected: map[string]dto.MetricType{"couchdb_httpd_requests_total": dto.MetricType_COUNTER, "couchdb_fabric_worker_total": dto.MetricType_COUNTER, "couchdb_httpd_open_databases": dto.MetricType_GAUGE},
+			missing:  []string{"couchdb_httpd_requests", "couchdb_fabric_worker"},
+		},
+		{
+			naming:   MetricNamingBoth,
+			expected: map[string]dto.MetricType{"couchdb_httpd_requests": dto.MetricType_GAUGE, "couchdb_httpd_requests_total": dto.MetricType_COUNTER},
+		},
+	}
+	nodeStats, err := os.ReadFile("../testdata/couchdb-stats-response-v2.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newCouchdbServer(map[string]string{
+		"/":                     `{"couchdb":"Welcome","version":"3.3.2"}`,
+		"/_membership":          `{"all_nodes":["node1@a"],"cluster_nodes":["node1@a"]}`,
+		"/_node/node1@a/_stats": string(nodeStats),
+	})
+	defer server.Close()
+
+	for _, test := range tests {
+		e, err := New(WithURI(server.URL), WithCollectorConfig(CollectorConfig{
+			Collectors:   onlyCollectors("node_stats", "fabric", "replicator", "mango"),
+			MetricNaming: test.naming,
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(e)
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		types := make(map[string]dto.MetricType)
+		for _, family := range families {
+			types[family.GetName()] = family.GetType()
+		}
+		for name, metricType := range test.expected {
+			if actual, ok := types[name]; !ok || actual != metricType {
+				t.Errorf("expected %s to be a %s with %s naming", name, metricType, test.naming)
+			}
+		}
+		for _, name := range test.missing {
+			if _, ok := types[name]; ok {
+				t.Errorf("expected no %s with %s naming", name, test.naming)
+			}
+		}
+	}
+}
+
+func TestParseMetricNaming(t *testing.T) {
+	naming, err := ParseMetricNaming("")
+	if err != nil || naming != MetricNamingLegacy {
+		t.Errorf("expected the legacy naming by default, got %s", naming)
+	}
+	if _, err := ParseMetricNaming("openmetrics"); err == nil {
+		t.Error("expected an error for an unknown naming")
+	}
+}
@@ -0,0 +1,148 @@
+package lib
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricDescs describe the metrics produced by a scrape, and the collector group each one belongs to.
+// The exporter's own metrics are defined here, the CouchDB metrics by the enabled collectors.
+// Collectors deriving their metrics from the responses, like the stats collector, add descriptions while scraping.
+type metricDescs struct {
+	requestCount *prometheus.Desc
+	sampleAge    *prometheus.Desc
+
+	scrapeDuration      *prometheus.Desc
+	scrapePhaseDuration *prometheus.Desc
+
+	circuitOpen      *prometheus.Desc
+	concurrencyLimit *prometheus.Desc
+
+	up *prometheus.Desc
+
+	namespace   string
+	constLabels prometheus.Labels
+	naming      MetricNaming
+
+	mu     sync.RWMutex
+	all    []*prometheus.Desc
+	groups map[*prometheus.Desc]CollectorGroup
+	// counters are the descriptions of the metrics exported as counters, counterTwins the counters exported
+	// in addition to the gauges of the same CouchDB counters with MetricNamingBoth
+	counters     map[*prometheus.Desc]bool
+	counterTwins map[*prometheus.Desc]*prometheus.Desc
+}
+
+// MetricNaming selects how the counters of CouchDB are exported
+type MetricNaming string
+
+const (
+	// MetricNamingLegacy exports counters as gauges without suffix, like couchdb_httpd_requests
+	MetricNamingLegacy MetricNaming = "legacy"
+	// MetricNamingPrometheus exports counters as counters with a _total suffix, like couchdb_httpd_requests_total
+	MetricNamingPrometheus MetricNaming = "prometheus"
+	// MetricNamingBoth exports the legacy gauges and the counters, to migrate dashboards and alerts
+	MetricNamingBoth MetricNaming = "both"
+)
+
+// ParseMetricNaming parses the metric naming, an empty naming defaults to MetricNamingLegacy
+func ParseMetricNaming(naming string) (MetricNaming, error) {
+	switch MetricNaming(naming) {
+	case "":
+		return MetricNamingLegacy, nil
+	case MetricNamingLegacy, MetricNamingPrometheus, MetricNamingBoth:
+		return MetricNaming(naming), nil
+	default:
+		return "", fmt.Errorf("invalid metric naming '%s', expected one of '%s', '%s' or '%s'", naming, MetricNamingLegacy, MetricNamingPrometheus, MetricNamingBoth)
+	}
+}
+
+func newMetricDescs(namespace string, constLabels prometheus.Labels, naming MetricNaming) *metricDescs {
+	d := &metricDescs{
+		namespace:    namespace,
+		constLabels:  constLabels,
+		naming:       naming,
+		groups:       make(map[*prometheus.Desc]CollectorGroup),
+		counters:     make(map[*prometheus.Desc]bool),
+		counterTwins: make(map[*prometheus.Desc]*prometheus.Desc),
+	}
+
+	d.requestCount = d.newDesc(CollectorGroupStandard, "exporter", "request_count", "Number of CouchDB requests for this scrape.")
+	d.sampleAge = d.newDesc(CollectorGroupDatabases, "exporter", "sample_age_seconds", "Age of the latest sample of a database, when databases are scraped in rotation due to the request budget.", "db_name")
+
+	d.scrapeDuration = d.newDesc(CollectorGroupStandard, "exporter", "scrape_duration_seconds", "Duration of the last scrape of CouchDB.")
+	d.scrapePhaseDuration = d.newDesc(CollectorGroupStandard, "exporter", "scrape_phase_duration_seconds", "Duration of the phases of the last scrape of CouchDB.", "phase")
+
+	d.circuitOpen = d.newDesc(CollectorGroupStandard, "exporter", "circuit_open", "Is the circuit breaker of a collector open, pausing its requests to CouchDB.", "collector")
+	d.concurrencyLimit = d.newDesc(CollectorGroupStandard, "exporter", "concurrency_limit", "Current adaptive limit of concurrent requests to CouchDB.")
+
+	d.up = d.newDesc(CollectorGroupStandard, "httpd", "up", "Was the last query of CouchDB stats successful.")
+
+	return d
+}
+
+// newDesc creates the description of a metric in the collector group
+func (d *metricDescs) newDesc(group CollectorGroup, subsystem string, name string, help string, variableLabels ...string) *prometheus.Desc {
+	desc := prometheus.NewDesc(prometheus.BuildFQName(d.namespace, subsystem, name), help, variableLabels, d.constLabels)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.all = append(d.all, desc)
+	d.groups[desc] = group
+	return desc
+}
+
+// newCounterDesc creates the description of a CouchDB counter, which is exported as configured by the metric naming.
+// Collectors set its values like gauges, the snapshot builder takes care of the counter types and names.
+func (d *metricDescs) newCounterDesc(group CollectorGroup, subsystem string, name string, help string, variableLabels ...string) *prometheus.Desc {
+	if d.naming != MetricNamingPrometheus && d.naming != MetricNamingBoth {
+		return d.newDesc(group, subsystem, name, help, variableLabels...)
+	}
+	counter := d.newDesc(group, subsystem, name+"_total", help, variableLabels...)
+	desc := counter
+	if d.naming == MetricNamingBoth {
+		desc = d.newDesc(group, subsystem, name, help, variableLabels...)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.counters[counter] = true
+	if desc != counter {
+		d.counterTwins[desc] = counter
+	}
+	return desc
+}
+
+// counterOf tells whether the metric is exported as counter, and returns the counter exported in addition to the metric
+func (d *metricDescs) counterOf(desc *prometheus.Desc) (bool, *prometheus.Desc) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.counters[desc], d.counterTwins[desc]
+}
+
+// scrapeDescs describe the exporter's own metrics of a scrape, which are served even when the scrape failed
+func (d *metricDescs) scrapeDescs() []*prometheus.Desc {
+	return []*prometheus.Desc{d.scrapeDuration, d.scrapePhaseDuration, d.circuitOpen, d.concurrencyLimit}
+}
+
+// inGroups returns the descriptions of the metrics belonging to the collector groups
+func (d *metricDescs) inGroups(groups ...CollectorGroup) []*prometheus.Desc {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var descs []*prometheus.Desc
+	for _, desc := range d.all {
+		for _, group := range groups {
+			if d.groups[desc] == group {
+				descs = append(descs, desc)
+			}
+		}
+	}
+	return descs
+}
+
+// groupOf returns the collector group of a metric description
+func (d *metricDescs) groupOf(desc *prometheus.Desc) CollectorGroup {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.groups[desc]
+}
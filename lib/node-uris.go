@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NodeUris maps the node names of a cluster, like "couchdb@host", to URIs at which the exporter reaches each node directly,
+// instead of through the coordinator behind the CouchDB URI. The Static mapping takes precedence over the Template.
+// An empty mapping disables direct scraping.
+type NodeUris struct {
+	Static map[string]string
+	// Template derives the URI from the node name, replacing {host} with the part after "@" and {name} with the part before,
+	// e.g. "https://{host}:5984"
+	Template string
+}
+
+// NodeProbe is the outcome of a direct request to a node
+type NodeProbe struct {
+	Reachable bool
+	Duration  time.Duration
+}
+
+// ParseNodeUris parses a static mapping like "couchdb@a=https://a:5984,couchdb@b=https://b:5984" and a template
+func ParseNodeUris(mapping string, template string) (NodeUris, error) {
+	nodeUris := NodeUris{Template: strings.TrimSpace(template)}
+	if nodeUris.Template != "" {
+		if _, err := url.Parse(nodeUris.uriFromTemplate("couchdb@localhost")); err != nil {
+			return NodeUris{}, fmt.Errorf("invalid node URI template '%s': %v", template, err)
+		}
+	}
+	mapping = strings.TrimSpace(mapping)
+	if mapping == "" {
+		return nodeUris, nil
+	}
+	nodeUris.Static = make(map[string]string)
+	for _, entry := range strings.Split(mapping, ",") {
+		name, uri, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" || uri == "" {
+			return NodeUris{}, fmt.Errorf("invalid node URI '%s', expected format 'node=uri'", entry)
+		}
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			return NodeUris{}, fmt.Errorf("invalid URI of node '%s': %v", name, err)
+		}
+		if parsed.Scheme == "" || parsed.Host == "" {
+			return NodeUris{}, fmt.Errorf("invalid URI of node '%s': scheme and host required", name)
+		}
+		nodeUris.Static[name] = strings.TrimSuffix(uri, "/")
+	}
+	return nodeUris, nil
+}
+
+// Enabled returns true if any node is scraped directly
+func (n NodeUris) Enabled() bool {
+	return len(n.Static) > 0 || n.Template != ""
+}
+
+// UriFor returns the URI of the node, or false if the node is scraped through the coordinator
+func (n NodeUris) UriFor(nodeName string) (string, bool) {
+	if uri, ok := n.Static[nodeName]; ok {
+		return uri, true
+	}
+	if n.Template == "" {
+		return "", false
+	}
+	return n.uriFromTemplate(nodeName), true
+}
+
+// StaticNodeNames returns the sorted names of the statically mapped nodes,
+// which are known without asking the coordinator for the cluster membership
+func (n NodeUris) StaticNodeNames() []string {
+	names := make([]string, 0, len(n.Static))
+	for name := range n.Static {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (n NodeUris) uriFromTemplate(nodeName string) string {
+	name, host, ok := strings.Cut(nodeName, "@")
+	if !ok {
+		host = nodeName
+	}
+	uri := strings.ReplaceAll(n.Template, "{host}", host)
+	uri = strings.ReplaceAll(uri, "{name}", name)
+	return strings.TrimSuffix(uri, "/")
+}
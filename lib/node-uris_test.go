@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNodeUris(t *testing.T) {
+	nodeUris, err := ParseNodeUris(" couchdb@a=https://a:5984/ , couchdb@b=https://b:5984", "https://{host}:6984")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		nodeName string
+		expected string
+	}{
+		{"couchdb@a", "https://a:5984"},
+		{"couchdb@b", "https://b:5984"},
+		{"couchdb@c.example.com", "https://c.example.com:6984"},
+		{"nonode", "https://nonode:6984"},
+	}
+	for _, test := range tests {
+		uri, ok := nodeUris.UriFor(test.nodeName)
+		if !ok || uri != test.expected {
+			t.Errorf("expected URI %s for %s, got %s", test.expected, test.nodeName, uri)
+		}
+	}
+	if names := nodeUris.StaticNodeNames(); strings.Join(names, ",") != "couchdb@a,couchdb@b" {
+		t.Errorf("expected the sorted static node names, got %v", names)
+	}
+
+	disabled, err := ParseNodeUris("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := disabled.UriFor("couchdb@a"); ok || disabled.Enabled() {
+		t.Errorf("expected an empty mapping to disable direct scraping")
+	}
+
+	for _, invalid := range []string{"couchdb@a", "=https://a:5984", "couchdb@a=", "couchdb@a=a:5984", "couchdb@a=/path"} {
+		if _, err := ParseNodeUris(invalid, ""); err == nil {
+			t.Errorf("expected an error for '%s'", invalid)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Option configures an Exporter created with New
+type Option func(*options)
+
+type options struct {
+	uri             string
+	localOnly       bool
+	basicAuth       BasicAuth
+	insecure        bool
+	collectorConfig CollectorConfig
+
+	httpClient   *http.Client
+	roundTripper http.RoundTripper
+	logger       *slog.Logger
+
+	namespace   string
+	constLabels prometheus.Labels
+}
+
+// WithURI sets the URI of the CouchDB instance, defaults to http://localhost:5984
+func WithURI(uri string) Option {
+	return func(o *options) {
+		o.uri = uri
+	}
+}
+
+// WithBasicAuth sets the credentials for CouchDB
+func WithBasicAuth(username string, password string) Option {
+	return func(o *options) {
+		o.basicAuth = BasicAuth{Username: username, Password: password}
+	}
+}
+
+// WithLocalOnly only collects the node stats of the node behind the URI, instead of the whole cluster
+func WithLocalOnly(localOnly bool) Option {
+	return func(o *options) {
+		o.localOnly = localOnly
+	}
+}
+
+// WithInsecure skips the verification of CouchDB's TLS certificate.
+// Ignored when a custom http.Client or http.RoundTripper is given.
+func WithInsecure(insecure bool) Option {
+	return func(o *options) {
+		o.insecure = insecure
+	}
+}
+
+// WithCollectorConfig sets the observed databases, the enabled collectors and the scrape settings
+func WithCollectorConfig(collectorConfig CollectorConfig) Option {
+	return func(o *options) {
+		o.collectorConfig = collectorConfig
+	}
+}
+
+// WithHTTPClient sends the requests to CouchDB with a copy of the client,
+// whose transport is wrapped to count and instrument the requests
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithRoundTripper sends the requests to CouchDB with the round tripper
+func WithRoundTripper(roundTripper http.RoundTripper) Option {
+	return func(o *options) {
+		o.roundTripper = roundTripper
+	}
+}
+
+// WithLogger sets the logger, defaults to slog.Default()
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithNamespace sets the namespace of the metric names, defaults to "couchdb"
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithConstLabels adds the labels to every metric, e.g. to tell several exporters in one registry apart
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(o *options) {
+		o.constLabels = labels
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		uri:       "http://localhost:5984",
+		namespace: namespace,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.logger == nil {
+		o.logger = slog.Default()
+	}
+	return o
+}
+
+// New creates an Exporter to be registered with a prometheus.Registry.
+// With a ScrapeInterval in the collector config, the asynchronous scraping has to be started with Start.
+func New(opts ...Option) (*Exporter, error) {
+	o := newOptions(opts...)
+	uri, err := url.Parse(o.uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CouchDB URI: %v", err)
+	}
+	if uri.Scheme == "" || uri.Host == "" {
+		return nil, fmt.Errorf("invalid CouchDB URI '%s': scheme and host required", o.uri)
+	}
+	return newExporter(o), nil
+}
@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type unavailableRoundTripper struct {
+	requests atomic.Int32
+}
+
+func (rt *unavailableRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.requests.Add(1)
+	return &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Body:       io.NopCloser(strings.NewReader(`{"error":"unavailable"}`)),
+		Header:     make(http.Header),
+		Request:    req,
+	}, nil
+}
+
+func TestNewInvalidURI(t *testing.T) {
+	for _, uri := range []string{"localhost:5984", "://localhost", ""} {
+		if _, err := New(WithURI(uri)); err == nil {
+			t.Errorf("expected an error for URI '%s'", uri)
+		}
+	}
+}
+
+func TestNewWithOptions(t *testing.T) {
+	roundTripper := &unavailableRoundTripper{}
+	registry := prometheus.NewRegistry()
+	for _, cluster := range []string{"a", "b"} {
+		e, err := New(
+			WithURI("http://couchdb-"+cluster+":5984"),
+			WithRoundTripper(roundTripper),
+			WithNamespace("cluster"),
+			WithConstLabels(prometheus.Labels{"cluster": cluster}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = registry.Register(e)
+		if err != nil {
+			t.Fatalf("expected exporters with different const labels to share a registry: %v", err)
+		}
+	}
+	if roundTripper.requests.Load() != 0 {
+		t.Errorf("expected no requests before the first collect, got %d", roundTripper.requests.Load())
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roundTripper.requests.Load() == 0 {
+		t.Error("expected the requests to be sent with the custom round tripper")
+	}
+	up := 0
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "cluster_") {
+			t.Errorf("expected the custom namespace, got %s", family.GetName())
+		}
+		if family.GetName() != "cluster_httpd_up" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			up++
+			if m.GetGauge().GetValue() != 0 {
+				t.Errorf("expected an unavailable CouchDB to be down, got %f", m.GetGauge().GetValue())
+			}
+		}
+	}
+	if up != 2 {
+		t.Errorf("expected one up metric per exporter, got %d", up)
+	}
+}
@@ -1,60 +1,270 @@
 package lib
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/semaphore"
 )
 
+// SemaphoreMetrics instrument the time spent waiting on semaphores and the requests in flight, per collector
+type SemaphoreMetrics struct {
+	WaitSeconds *prometheus.HistogramVec
+	InFlight    *prometheus.GaugeVec
+}
+
+// Semaphore limits concurrent work by weight; heavier requests take several slots
 type Semaphore struct {
-	abort       chan struct{}
-	sem         chan struct{}
+	weighted    *semaphore.Weighted // nil for unlimited concurrency
+	abort       context.Context     // cancelled to abort goroutines waiting on the semaphore
+	cancel      context.CancelFunc
+	inFlight    *atomic.Int64
 	concurrency uint
+	collector   string
+	metrics     *SemaphoreMetrics
 }
 
 // NewSemaphore for concurrency, concurrency == 0 means unlimited
 func NewSemaphore(concurrency uint) Semaphore {
+	return NewInstrumentedSemaphore(concurrency, "", nil)
+}
+
+// NewInstrumentedSemaphore for concurrency, recording wait times and requests in flight for the collector.
+// Unlimited semaphores never wait, so they aren't recorded.
+func NewInstrumentedSemaphore(concurrency uint, collector string, metrics *SemaphoreMetrics) Semaphore {
+	abort, cancel := context.WithCancel(context.Background())
 	s := Semaphore{
-		sem:         make(chan struct{}, concurrency),
-		abort:       make(chan struct{}), // signal to abort for goroutines waiting on a semaphore
+		abort:       abort,
+		cancel:      cancel,
+		inFlight:    &atomic.Int64{},
 		concurrency: concurrency,
+		collector:   collector,
+		metrics:     metrics,
 	}
-	if concurrency == 0 {
-		close(s.sem) // concurrency effectively unlimited
-		return s
-	}
-	// fill semaphore
-	for i := 0; i < int(s.concurrency); i++ {
-		s.sem <- struct{}{}
+	if concurrency > 0 {
+		s.weighted = semaphore.NewWeighted(int64(concurrency))
 	}
 	return s
 }
 
 // Acquire the semaphore; blocks until ready, or returns error to indicate the goroutine should abort
 func (s Semaphore) Acquire() error {
-	select {
-	case <-s.abort:
+	return s.AcquireWeighted(context.Background(), 1)
+}
+
+// AcquireWeighted acquires weight slots of the semaphore; blocks until ready,
+// or returns error when the context is done or the semaphore has been aborted.
+// Weights beyond the semaphore's concurrency are capped, so that heavy requests still run one at a time.
+func (s Semaphore) AcquireWeighted(ctx context.Context, weight int64) error {
+	if s.abort.Err() != nil {
 		return fmt.Errorf("could not acquire semaphore")
-	case <-s.sem:
-		return nil
 	}
+	if s.weighted == nil {
+		return ctx.Err()
+	}
+	weight = s.capWeight(weight)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(s.abort, cancel)
+	defer stop()
+
+	start := time.Now()
+	err := s.weighted.Acquire(ctx, weight)
+	if s.metrics != nil {
+		s.metrics.WaitSeconds.WithLabelValues(s.collector).Observe(time.Since(start).Seconds())
+	}
+	if err != nil {
+		return fmt.Errorf("could not acquire semaphore: %w", err)
+	}
+	s.inFlight.Add(weight)
+	if s.metrics != nil {
+		s.metrics.InFlight.WithLabelValues(s.collector).Add(float64(weight))
+	}
+	return nil
 }
 
 func (s Semaphore) Release() {
-	if s.concurrency > 0 {
-		select {
-		case s.sem <- struct{}{}:
-		default: // should not happen unless someone double released
-		}
+	s.ReleaseWeighted(1)
+}
+
+// ReleaseWeighted releases the weight acquired with AcquireWeighted
+func (s Semaphore) ReleaseWeighted(weight int64) {
+	if s.weighted == nil {
+		return
+	}
+	weight = s.capWeight(weight)
+	if s.inFlight.Add(-weight) < 0 {
+		// should not happen unless someone double released
+		s.inFlight.Add(weight)
+		return
 	}
+	if s.metrics != nil {
+		s.metrics.InFlight.WithLabelValues(s.collector).Sub(float64(weight))
+	}
+	s.weighted.Release(weight)
 }
 
 // Signal abort for anyone waiting on the Semaphore
 func (s Semaphore) Abort() {
-	select {
-	case <-s.abort:
-		// a check if we've already closed the abort channel
+	s.cancel()
+}
+
+func (s Semaphore) capWeight(weight int64) int64 {
+	if weight < 1 {
+		return 1
+	}
+	if weight > int64(s.concurrency) {
+		return int64(s.concurrency)
+	}
+	return weight
+}
+
+// AdaptiveLimiter limits the concurrent calls to CouchDB, adapting the limit to CouchDB's health:
+// the limit is halved when responses are slow or fail with a 5xx status,
+// and grows again slowly while CouchDB responds fast.
+type AdaptiveLimiter struct {
+	mutex            sync.Mutex
+	cond             *sync.Cond
+	limit            float64
+	maxLimit         float64
+	inFlight         int
+	latencyThreshold time.Duration
+	lastDecrease     time.Time
+}
+
+// NewAdaptiveLimiter starting with maxConcurrency, which is also the upper bound for the adapted limit
+func NewAdaptiveLimiter(maxConcurrency uint, latencyThreshold time.Duration) *AdaptiveLimiter {
+	if maxConcurrency == 0 {
+		maxConcurrency = 1
+	}
+	l := &AdaptiveLimiter{
+		limit:            float64(maxConcurrency),
+		maxLimit:         float64(maxConcurrency),
+		latencyThreshold: latencyThreshold,
+	}
+	l.cond = sync.NewCond(&l.mutex)
+	return l
+}
+
+// Acquire a slot; blocks until the number of calls in flight is below the current limit,
+// or fails when the context is done
+func (l *AdaptiveLimiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	// wake up the waiting calls, so that they notice the done context
+	stop := context.AfterFunc(ctx, func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.cond.Broadcast()
+	})
+	defer stop()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for l.inFlight >= int(l.limit) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.cond.Wait()
+	}
+	l.inFlight++
+	return nil
+}
+
+// Release a slot, adapting the limit to the observed latency and status code.
+// A status code of 0 denotes a failed request without response.
+func (l *AdaptiveLimiter) Release(latency time.Duration, statusCode int) {
+	if l == nil {
 		return
-	default:
-		// abort channel now never blocks for receivers
-		close(s.abort)
 	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.inFlight--
+
+	unhealthy := statusCode == 0 || statusCode >= 500 || (l.latencyThreshold > 0 && latency > l.latencyThreshold)
+	if unhealthy {
+		// decrease at most once per latency threshold, so that a burst
+		// of slow responses doesn't collapse the limit at once
+		if time.Since(l.lastDecrease) > l.latencyThreshold {
+			l.limit = math.Max(1, l.limit/2)
+			l.lastDecrease = time.Now()
+		}
+	} else {
+		l.limit = math.Min(l.maxLimit, l.limit+1/l.limit)
+	}
+	l.cond.Broadcast()
+}
+
+// Limit returns the current concurrency limit
+func (l *AdaptiveLimiter) Limit() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return int(l.limit)
+}
+
+// CircuitBreaker pauses expensive operations after consecutive failures.
+// After the cooldown a single attempt is allowed again, which either closes
+// the circuit on success or keeps it open for another cooldown.
+type CircuitBreaker struct {
+	mutex               sync.Mutex
+	maxFailures         uint
+	cooldown            time.Duration
+	consecutiveFailures uint
+	openedAt            time.Time
+}
+
+// NewCircuitBreaker opening after maxFailures consecutive failures, maxFailures == 0 disables the breaker
+func NewCircuitBreaker(maxFailures uint, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		maxFailures: maxFailures,
+		cooldown:    cooldown,
+	}
+}
+
+// Allow returns true if the circuit is closed, or if the cooldown of an open circuit has passed
+func (b *CircuitBreaker) Allow() bool {
+	if b == nil || b.maxFailures == 0 {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.consecutiveFailures < b.maxFailures || time.Since(b.openedAt) >= b.cooldown
+}
+
+func (b *CircuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.consecutiveFailures = 0
+}
+
+func (b *CircuitBreaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.consecutiveFailures++
+	if b.maxFailures > 0 && b.consecutiveFailures >= b.maxFailures {
+		b.openedAt = time.Now()
+	}
+}
+
+// IsOpen returns true while operations are paused
+func (b *CircuitBreaker) IsOpen() bool {
+	if b == nil || b.maxFailures == 0 {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.consecutiveFailures >= b.maxFailures
 }
@@ -1,8 +1,12 @@
 package lib
 
 import (
+	"context"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // worker goroutine; should take no less than 1ms to complete.
@@ -79,3 +83,200 @@ func TestAbort(t *testing.T) {
 		t.Error("Somehow all workers completed their jobs despite an abort")
 	}
 }
+
+func TestAdaptiveLimiter(t *testing.T) {
+	limiter := NewAdaptiveLimiter(8, 100*time.Millisecond)
+	if limiter.Limit() != 8 {
+		t.Fatalf("expected initial limit 8, got %d", limiter.Limit())
+	}
+
+	limiter.Acquire(context.Background())
+	limiter.Release(time.Millisecond, 503)
+	if limiter.Limit() != 4 {
+		t.Errorf("expected limit 4 after a 5xx response, got %d", limiter.Limit())
+	}
+
+	// a burst of failures only shrinks the limit once per latency threshold
+	limiter.Acquire(context.Background())
+	limiter.Release(time.Second, 200)
+	if limiter.Limit() != 4 {
+		t.Errorf("expected limit 4 within the latency threshold, got %d", limiter.Limit())
+	}
+
+	for i := 0; i < 100; i++ {
+		limiter.Acquire(context.Background())
+		limiter.Release(time.Millisecond, 200)
+	}
+	if limiter.Limit() != 8 {
+		t.Errorf("expected limit to recover to 8, got %d", limiter.Limit())
+	}
+}
+
+func TestAdaptiveLimiterBlocksAtLimit(t *testing.T) {
+	limiter := NewAdaptiveLimiter(1, time.Second)
+	limiter.Acquire(context.Background())
+
+	acquired := make(chan struct{})
+	go func() {
+		limiter.Acquire(context.Background())
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired a slot beyond the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	limiter.Release(time.Millisecond, 200)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("slot not acquired after release")
+	}
+}
+
+func TestAdaptiveLimiterCancel(t *testing.T) {
+	limiter := NewAdaptiveLimiter(1, time.Second)
+	err := limiter.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	acquired := make(chan error)
+	go func() {
+		acquired <- limiter.Acquire(ctx)
+	}()
+	cancel()
+	select {
+	case err := <-acquired:
+		if err == nil {
+			t.Error("expected waiting acquire to fail on cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting acquire not cancelled")
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := NewCircuitBreaker(2, 50*time.Millisecond)
+
+	breaker.Failure()
+	if breaker.IsOpen() || !breaker.Allow() {
+		t.Fatal("expected closed circuit after a single failure")
+	}
+	breaker.Failure()
+	if !breaker.IsOpen() || breaker.Allow() {
+		t.Fatal("expected open circuit after consecutive failures")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !breaker.Allow() {
+		t.Fatal("expected a retry after the cooldown")
+	}
+	breaker.Failure()
+	if breaker.Allow() {
+		t.Fatal("expected failed retry to start another cooldown")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	breaker.Success()
+	if breaker.IsOpen() || !breaker.Allow() {
+		t.Fatal("expected closed circuit after success")
+	}
+}
+
+func TestDisabledCircuitBreaker(t *testing.T) {
+	var nilBreaker *CircuitBreaker
+	disabled := NewCircuitBreaker(0, time.Minute)
+	for _, breaker := range []*CircuitBreaker{nilBreaker, disabled} {
+		for i := 0; i < 10; i++ {
+			breaker.Failure()
+		}
+		if breaker.IsOpen() || !breaker.Allow() {
+			t.Error("expected disabled circuit breaker to stay closed")
+		}
+	}
+}
+
+func TestWeightedSemaphore(t *testing.T) {
+	metrics := &SemaphoreMetrics{
+		WaitSeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "wait"}, []string{"collector"}),
+		InFlight:    prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "in_flight"}, []string{"collector"}),
+	}
+	sem := NewInstrumentedSemaphore(3, "views", metrics)
+
+	err := sem.AcquireWeighted(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inFlight := gaugeValue(t, metrics.InFlight.WithLabelValues("views")); inFlight != 2 {
+		t.Errorf("expected 2 in flight, got %f", inFlight)
+	}
+
+	// a second heavy request has to wait for the first one
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = sem.AcquireWeighted(ctx, 2)
+	if err == nil {
+		t.Fatal("expected acquire to fail when its context is done")
+	}
+	err = sem.AcquireWeighted(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sem.ReleaseWeighted(2)
+	sem.ReleaseWeighted(1)
+	sem.ReleaseWeighted(1) // double release is ignored
+	if inFlight := gaugeValue(t, metrics.InFlight.WithLabelValues("views")); inFlight != 0 {
+		t.Errorf("expected nothing in flight, got %f", inFlight)
+	}
+
+	// weights beyond the concurrency are capped
+	err = sem.AcquireWeighted(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sem.ReleaseWeighted(10)
+
+	var m dto.Metric
+	err = metrics.WaitSeconds.WithLabelValues("views").(prometheus.Histogram).Write(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := m.GetHistogram().GetSampleCount(); count != 4 {
+		t.Errorf("expected 4 observed waits, got %d", count)
+	}
+}
+
+func TestAbortWeightedSemaphore(t *testing.T) {
+	sem := NewSemaphore(1)
+	err := sem.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aborted := make(chan error)
+	go func() {
+		aborted <- sem.AcquireWeighted(context.Background(), 1)
+	}()
+	sem.Abort()
+	select {
+	case err := <-aborted:
+		if err == nil {
+			t.Error("expected waiting acquire to fail on abort")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting acquire not aborted")
+	}
+}
+
+func gaugeValue(t *testing.T, gauge prometheus.Gauge) float64 {
+	var m dto.Metric
+	err := gauge.Write(&m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.GetGauge().GetValue()
+}